@@ -0,0 +1,218 @@
+package ezadmis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrMissingSubjectAccessReviewSpec SubjectAccessReview has no user, group or attributes, responded with HTTP 400
+var ErrMissingSubjectAccessReviewSpec = errors.New("missing spec in SubjectAccessReview")
+
+// AuthorizationDecision decision of AuthorizationHandler
+type AuthorizationDecision int
+
+const (
+	// AuthorizationNoOpinion neither allow nor deny, leaving the decision to other authorizers, the default
+	AuthorizationNoOpinion AuthorizationDecision = iota
+	// AuthorizationAllow allow the request
+	AuthorizationAllow
+	// AuthorizationDeny deny the request, short-circuiting other authorizers
+	AuthorizationDeny
+)
+
+// String implements fmt.Stringer
+func (d AuthorizationDecision) String() string {
+	switch d {
+	case AuthorizationAllow:
+		return "allowed"
+	case AuthorizationDeny:
+		return "denied"
+	default:
+		return "no-opinion"
+	}
+}
+
+// AuthorizationHandler function to authorize a SubjectAccessReview sent by API server, reason is shown to
+// client and in audit logs
+type AuthorizationHandler func(ctx context.Context, spec *authorizationv1.SubjectAccessReviewSpec) (decision AuthorizationDecision, reason string, err error)
+
+// WrapAuthorizationHandlerOptions options for wrapping AuthorizationHandler
+type WrapAuthorizationHandlerOptions struct {
+	Debug bool
+	// Timeout max duration of AuthorizationHandler, zero means no limit; API server sends no timeout,
+	// configure it below the authorization webhook timeout of API server
+	Timeout time.Duration
+	// Logger logger, default to slog.Default()
+	Logger *slog.Logger
+	// MaxBodySize max size of request body in bytes, default to DefaultMaxBodySize
+	MaxBodySize int64
+}
+
+// WrapAuthorizationHandler wrap AuthorizationHandler to http.HandlerFunc, serving SubjectAccessReview of
+// authorization.k8s.io/v1; handler errors, panics and timeouts are answered with no opinion and an evaluation
+// error, leaving the decision to other authorizers
+func WrapAuthorizationHandler(opts WrapAuthorizationHandlerOptions, handler AuthorizationHandler) http.HandlerFunc {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	summaryLevel := slog.LevelDebug
+	if opts.Debug {
+		summaryLevel = slog.LevelInfo
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		var (
+			err    error
+			review authorizationv1.SubjectAccessReview
+			logger = opts.Logger.With("path", req.URL.Path)
+		)
+
+		// automatically error returning
+		defer func() {
+			if err == nil {
+				return
+			}
+			logger.Error("authorization http handler failed", "error", err.Error())
+			writeErrorResponse(rw, err)
+		}()
+
+		// validate request
+		var buf []byte
+		if buf, err = readReviewRequest(rw, req, opts.MaxBodySize); err != nil {
+			return
+		}
+
+		// decode request
+		if err = json.Unmarshal(buf, &review); err != nil {
+			err = errors.New("failed to unmarshal SubjectAccessReview request: " + err.Error())
+			return
+		}
+		if review.APIVersion != "" && review.APIVersion != authorizationv1.SchemeGroupVersion.String() {
+			err = errors.New("unsupported SubjectAccessReview version: " + review.APIVersion)
+			return
+		}
+		if review.Spec.User == "" && len(review.Spec.Groups) == 0 {
+			err = ErrMissingSubjectAccessReviewSpec
+			return
+		}
+		if review.Spec.ResourceAttributes == nil && review.Spec.NonResourceAttributes == nil {
+			err = ErrMissingSubjectAccessReviewSpec
+			return
+		}
+
+		logger = logger.With(authorizationLogAttrs(&review.Spec)...)
+
+		if opts.Debug {
+			raw, _ := json.MarshalIndent(review, "", "  ")
+			logger.Info("authorization request received", "review", string(raw))
+		}
+
+		// execute handler
+		ctx := req.Context()
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+
+		type result struct {
+			decision AuthorizationDecision
+			reason   string
+			err      error
+		}
+
+		chResult := make(chan result, 1)
+
+		go func() {
+			var r result
+			r.decision, r.reason, r.err = invokeAuthorizationHandler(ctx, logger, handler, review.Spec.DeepCopy())
+			chResult <- r
+		}()
+
+		var r result
+
+		select {
+		case r = <-chResult:
+		case <-ctx.Done():
+			r.err = errors.New("AuthorizationHandler timed out")
+		}
+
+		status := authorizationv1.SubjectAccessReviewStatus{Reason: r.reason}
+		if r.err != nil {
+			status.Reason = ""
+			status.EvaluationError = r.err.Error()
+			logger.Error("authorization handler failed", "error", r.err.Error())
+		} else {
+			status.Allowed = r.decision == AuthorizationAllow
+			status.Denied = r.decision == AuthorizationDeny
+		}
+
+		// send response
+		out := authorizationv1.SubjectAccessReview{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: authorizationv1.SchemeGroupVersion.String(),
+				Kind:       "SubjectAccessReview",
+			},
+			Status: status,
+		}
+
+		if err = writeJSONResponse(rw, out, logger, opts.Debug, "authorization response sent"); err != nil {
+			return
+		}
+
+		logger.Log(req.Context(), summaryLevel, "authorization request handled", "decision", r.decision.String(), "reason", status.Reason)
+	}
+}
+
+// authorizationLogAttrs attributes of spec for logging
+func authorizationLogAttrs(spec *authorizationv1.SubjectAccessReviewSpec) []any {
+	attrs := []any{"user", spec.User}
+	if ra := spec.ResourceAttributes; ra != nil {
+		attrs = append(attrs,
+			"verb", ra.Verb,
+			"group", ra.Group,
+			"resource", ra.Resource,
+			"subresource", ra.Subresource,
+			"namespace", ra.Namespace,
+			"name", ra.Name,
+		)
+	}
+	if nra := spec.NonResourceAttributes; nra != nil {
+		attrs = append(attrs, "verb", nra.Verb, "nonResourcePath", nra.Path)
+	}
+	return attrs
+}
+
+// invokeAuthorizationHandler invoke handler, recovering panic into error
+func invokeAuthorizationHandler(ctx context.Context, logger *slog.Logger, handler AuthorizationHandler, spec *authorizationv1.SubjectAccessReviewSpec) (decision AuthorizationDecision, reason string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("authorization handler panicked", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			decision, reason, err = AuthorizationNoOpinion, "", errors.New("AuthorizationHandler panicked")
+		}
+	}()
+	return handler(ctx, spec)
+}
+
+// AuthorizationRoute a AuthorizationHandler mounted on a path
+type AuthorizationRoute struct {
+	// Path path to mount, see http.ServeMux
+	Path string
+	// Options options for wrapping Handler
+	Options WrapAuthorizationHandlerOptions
+	// Handler the AuthorizationHandler
+	Handler AuthorizationHandler
+}
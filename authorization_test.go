@@ -0,0 +1,84 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func postSubjectAccessReview(t *testing.T, h http.Handler, spec authorizationv1.SubjectAccessReviewSpec) authorizationv1.SubjectAccessReviewStatus {
+	buf, err := json.Marshal(authorizationv1.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: authorizationv1.SchemeGroupVersion.String(),
+			Kind:       "SubjectAccessReview",
+		},
+		Spec: spec,
+	})
+	require.NoError(t, err)
+
+	hreq := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf))
+	hreq.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, hreq)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res authorizationv1.SubjectAccessReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, authorizationv1.SchemeGroupVersion.String(), res.APIVersion)
+	return res.Status
+}
+
+func TestWrapAuthorizationHandler(t *testing.T) {
+	h := WrapAuthorizationHandler(WrapAuthorizationHandlerOptions{Timeout: time.Millisecond * 50}, func(ctx context.Context, spec *authorizationv1.SubjectAccessReviewSpec) (AuthorizationDecision, string, error) {
+		switch spec.User {
+		case "alice":
+			return AuthorizationAllow, "alice is admin", nil
+		case "bob":
+			return AuthorizationDeny, "bob is banned", nil
+		case "error":
+			return AuthorizationAllow, "ignored", errors.New("boom")
+		case "panic":
+			panic("boom")
+		case "slow":
+			<-ctx.Done()
+			time.Sleep(time.Millisecond * 10)
+			return AuthorizationAllow, "", nil
+		}
+		return AuthorizationNoOpinion, "", nil
+	})
+
+	spec := func(user string) authorizationv1.SubjectAccessReviewSpec {
+		return authorizationv1.SubjectAccessReviewSpec{
+			User:               user,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{Verb: "get", Resource: "pods", Namespace: "default"},
+		}
+	}
+
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{Allowed: true, Reason: "alice is admin"}, postSubjectAccessReview(t, h, spec("alice")))
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{Denied: true, Reason: "bob is banned"}, postSubjectAccessReview(t, h, spec("bob")))
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{}, postSubjectAccessReview(t, h, spec("carol")))
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{EvaluationError: "boom"}, postSubjectAccessReview(t, h, spec("error")))
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{EvaluationError: "AuthorizationHandler panicked"}, postSubjectAccessReview(t, h, spec("panic")))
+	require.Equal(t, authorizationv1.SubjectAccessReviewStatus{EvaluationError: "AuthorizationHandler timed out"}, postSubjectAccessReview(t, h, spec("slow")))
+
+	rec := httptest.NewRecorder()
+	hreq := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"apiVersion":"authorization.k8s.io/v1","kind":"SubjectAccessReview","spec":{"user":"alice"}}`)))
+	hreq.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, hreq)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+}
@@ -0,0 +1,81 @@
+package ezadmis
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// certificateLoader load a x509 key pair from files, and reload it when files changed
+type certificateLoader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+	cert     atomic.Pointer[tls.Certificate]
+	sum      [sha256.Size]byte
+}
+
+// load load key pair if content of files changed since last call, a key pair failed to parse
+// is not retried until files changed again
+func (l *certificateLoader) load() (changed bool, err error) {
+	var crt, key []byte
+	if crt, err = os.ReadFile(l.certFile); err != nil {
+		return
+	}
+	if key, err = os.ReadFile(l.keyFile); err != nil {
+		return
+	}
+
+	sum := sha256.Sum256(append(append(crt, 0), key...))
+	if sum == l.sum {
+		return
+	}
+	l.sum = sum
+
+	var cert tls.Certificate
+	if cert, err = tls.X509KeyPair(crt, key); err != nil {
+		return
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return
+		}
+	}
+	l.cert.Store(&cert)
+
+	changed = true
+	return
+}
+
+// watch poll files every interval, until ctx is done
+func (l *certificateLoader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if changed, err := l.load(); err != nil {
+			l.logger.Error("failed to reload certificate, keep serving the old one", "error", err.Error())
+		} else if changed {
+			l.logger.Info("certificate reloaded", "expires", l.cert.Load().Leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
+func (l *certificateLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := l.cert.Load(); cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("certificate not loaded")
+}
@@ -0,0 +1,81 @@
+package ezadmis
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+)
+
+func TestCertificateLoader(t *testing.T) {
+	dir := t.TempDir()
+
+	l := &certificateLoader{
+		certFile: filepath.Join(dir, "tls.crt"),
+		keyFile:  filepath.Join(dir, "tls.key"),
+		logger:   slog.Default(),
+	}
+
+	write := func(names ...string) x509util.PEMPair {
+		pair, err := x509util.Generate(x509util.GenerateOptions{IsCA: true, Names: names})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(l.certFile, pair.Crt, 0644))
+		require.NoError(t, os.WriteFile(l.keyFile, pair.Key, 0600))
+		return pair
+	}
+
+	write("first")
+
+	changed, err := l.load()
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "first", l.cert.Load().Leaf.Subject.CommonName)
+
+	changed, err = l.load()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.watch(ctx, time.Millisecond*10)
+
+	// broken key pair keeps the old certificate
+	require.NoError(t, os.WriteFile(l.keyFile, []byte("broken"), 0600))
+	time.Sleep(time.Millisecond * 50)
+	require.Equal(t, "first", l.cert.Load().Leaf.Subject.CommonName)
+
+	write("second")
+	require.Eventually(t, func() bool {
+		cert, err := l.GetCertificate(nil)
+		return err == nil && cert.Leaf.Subject.CommonName == "second"
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestWebhookServerStopWatchingOnListenFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	pair, err := x509util.Generate(x509util.GenerateOptions{IsCA: true, Names: []string{"test"}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), pair.Crt, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), pair.Key, 0600))
+
+	// occupy the port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	s := NewWebhookServer(WebhookServerOptions{
+		Port:               l.Addr().(*net.TCPAddr).Port,
+		CertFile:           filepath.Join(dir, "tls.crt"),
+		KeyFile:            filepath.Join(dir, "tls.key"),
+		CertReloadInterval: time.Millisecond * 10,
+	})
+	require.Error(t, s.ListenAndServe())
+	require.Error(t, s.(*webhookServer).ctx.Err())
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	kubeconfigCluster = "ezadmis-install"
+	kubeconfigUser    = "kube-apiserver"
+)
+
+// renderAuthorizationKubeconfig render the kubeconfig format file for '--authorization-webhook-config-file'
+// of API server, pointing to opts.AuthorizationServer and trusting caCrt; there is no default server, since API
+// server running with host network usually can not resolve DNS names of services, the server name is verified
+// against the service DNS name instead, so any address reaching the service works
+func renderAuthorizationKubeconfig(opts Options, caCrt []byte) ([]byte, error) {
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters[kubeconfigCluster] = &clientcmdapi.Cluster{
+		Server:                   opts.AuthorizationServer,
+		TLSServerName:            opts.Name + "." + opts.Namespace + ".svc",
+		CertificateAuthorityData: caCrt,
+	}
+	cfg.AuthInfos[kubeconfigUser] = &clientcmdapi.AuthInfo{
+		ClientCertificate: opts.AuthorizationClientCertificate,
+		ClientKey:         opts.AuthorizationClientKey,
+	}
+	cfg.Contexts[kubeconfigCluster] = &clientcmdapi.Context{
+		Cluster:  kubeconfigCluster,
+		AuthInfo: kubeconfigUser,
+	}
+	cfg.CurrentContext = kubeconfigCluster
+
+	return clientcmd.Write(*cfg)
+}
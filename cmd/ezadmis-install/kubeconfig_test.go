@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestRenderAuthorizationKubeconfig(t *testing.T) {
+	opts := testOptions()
+	opts.Authorization = true
+	opts.AuthorizationServer = "https://10.96.0.100:443/authorize"
+	opts.AuthorizationClientCertificate = "/etc/kubernetes/pki/apiserver-webhook.crt"
+	opts.AuthorizationClientKey = "/etc/kubernetes/pki/apiserver-webhook.key"
+
+	buf, err := renderAuthorizationKubeconfig(opts, testPEMPair.Crt)
+	require.NoError(t, err)
+
+	cfg, err := clientcmd.Load(buf)
+	require.NoError(t, err)
+	require.Equal(t, kubeconfigCluster, cfg.CurrentContext)
+
+	cluster := cfg.Clusters[cfg.Contexts[cfg.CurrentContext].Cluster]
+	require.Equal(t, "https://10.96.0.100:443/authorize", cluster.Server)
+	require.Equal(t, "demo.default.svc", cluster.TLSServerName)
+	require.Equal(t, testPEMPair.Crt, cluster.CertificateAuthorityData)
+
+	user := cfg.AuthInfos[cfg.Contexts[cfg.CurrentContext].AuthInfo]
+	require.Equal(t, "/etc/kubernetes/pki/apiserver-webhook.crt", user.ClientCertificate)
+	require.Equal(t, "/etc/kubernetes/pki/apiserver-webhook.key", user.ClientKey)
+}
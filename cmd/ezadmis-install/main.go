@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/creasty/defaults"
@@ -16,14 +19,18 @@ import (
 	"github.com/yankeguo/ezadmis/pkg/x509util"
 	"github.com/yankeguo/rg"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/csaupgrade"
 )
 
 const (
@@ -37,10 +44,18 @@ type Options struct {
 	Namespace string `json:"namespace"`
 
 	Mutating       bool                                         `json:"mutating"`
-	AdmissionRules []admissionregistrationv1.RuleWithOperations `json:"admissionRules" validate:"required"`
+	AdmissionRules []admissionregistrationv1.RuleWithOperations `json:"admissionRules"`
 	SideEffects    admissionregistrationv1.SideEffectClass      `json:"sideEffects" default:"NoneOnDryRun" validate:"required"`
 	FailurePolicy  admissionregistrationv1.FailurePolicyType    `json:"failurePolicy" default:"Fail" validate:"required"`
 
+	NamespaceSelector       *metav1.LabelSelector                          `json:"namespaceSelector"`
+	ObjectSelector          *metav1.LabelSelector                          `json:"objectSelector"`
+	TimeoutSeconds          int32                                          `json:"timeoutSeconds" default:"10" validate:"min=1,max=30"`
+	MatchPolicy             admissionregistrationv1.MatchPolicyType        `json:"matchPolicy" default:"Equivalent" validate:"oneof=Exact Equivalent"`
+	ReinvocationPolicy      admissionregistrationv1.ReinvocationPolicyType `json:"reinvocationPolicy" default:"Never" validate:"oneof=Never IfNeeded"`
+	MatchConditions         []admissionregistrationv1.MatchCondition       `json:"matchConditions" validate:"max=64"`
+	AdmissionReviewVersions []string                                       `json:"admissionReviewVersions" default:"[\"v1\"]" validate:"min=1,dive,oneof=v1 v1beta1"`
+
 	Image            string                        `json:"image" validate:"required"`
 	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets"`
 	ImagePullPolicy  corev1.PullPolicy             `json:"imagePullPolicy" default:"Always"`
@@ -48,6 +63,7 @@ type Options struct {
 	NodeSelector     map[string]string             `json:"nodeSelector"`
 	ServiceAccount   string                        `json:"serviceAccount"`
 	Port             int                           `json:"port" default:"443" validate:"required"`
+	Probes           bool                          `json:"probes"`
 	Env              []corev1.EnvVar               `json:"env"`
 	Command          []string                      `json:"command"`
 	Args             []string                      `json:"args"`
@@ -58,6 +74,66 @@ type Options struct {
 	Containers       []corev1.Container            `json:"containers"`
 	Resources        corev1.ResourceRequirements   `json:"resources"`
 	InitContainers   []corev1.Container            `json:"initContainers"`
+
+	Authorization                  bool   `json:"authorization"`
+	AuthorizationServer            string `json:"authorizationServer"`
+	AuthorizationClientCertificate string `json:"authorizationClientCertificate"`
+	AuthorizationClientKey         string `json:"authorizationClientKey"`
+}
+
+// validateOptions validate options beyond struct tags
+func validateOptions(opts Options) error {
+	if opts.Authorization {
+		if opts.AuthorizationServer == "" {
+			return errors.New("authorizationServer: required by authorization webhooks")
+		}
+	} else if len(opts.AdmissionRules) == 0 {
+		return errors.New("admissionRules: required unless authorization is set")
+	}
+	for _, mount := range opts.VolumeMounts {
+		if mountPath := path.Clean(mount.MountPath); isTLSReloadable(opts) && mountPath == tlsMountDir || mountPath == path.Clean(opts.TLSCrtPath) || mountPath == path.Clean(opts.TLSKeyPath) {
+			return errors.New("volumeMounts: " + strconv.Quote(mount.MountPath) + " is reserved for certificate and key")
+		}
+	}
+	if !opts.Mutating && opts.ReinvocationPolicy != admissionregistrationv1.NeverReinvocationPolicy {
+		return errors.New("reinvocationPolicy: only supported by mutating webhooks")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(opts.NamespaceSelector); err != nil {
+		return errors.New("namespaceSelector: " + err.Error())
+	}
+	if _, err := metav1.LabelSelectorAsSelector(opts.ObjectSelector); err != nil {
+		return errors.New("objectSelector: " + err.Error())
+	}
+	names := map[string]bool{}
+	for i, cond := range opts.MatchConditions {
+		prefix := "matchConditions[" + strconv.Itoa(i) + "]: "
+		if errs := validation.IsQualifiedName(cond.Name); len(errs) != 0 {
+			return errors.New(prefix + "invalid name " + strconv.Quote(cond.Name) + ": " + strings.Join(errs, "; "))
+		}
+		if names[cond.Name] {
+			return errors.New(prefix + "duplicated name " + strconv.Quote(cond.Name))
+		}
+		names[cond.Name] = true
+		if strings.TrimSpace(cond.Expression) == "" {
+			return errors.New(prefix + "missing expression")
+		}
+	}
+	return nil
+}
+
+func createProbe(opts Options, path string) *corev1.Probe {
+	if !opts.Probes {
+		return nil
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   path,
+				Port:   intstr.FromInt(opts.Port),
+				Scheme: corev1.URISchemeHTTPS,
+			},
+		},
+	}
 }
 
 func detectNamespace() (string, error) {
@@ -80,9 +156,12 @@ func createClient() (client *kubernetes.Clientset, err error) {
 	return kubernetes.NewForConfig(cfg)
 }
 
+const fieldManager = "ezadmis-install"
+
 type resourceAPI[T any] interface {
 	Get(ctx context.Context, name string, opts metav1.GetOptions) (*T, error)
 	Create(ctx context.Context, obj *T, opts metav1.CreateOptions) (*T, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts metav1.PatchOptions, subresources ...string) (*T, error)
 }
 
 func detectResourceName(v any) string {
@@ -98,45 +177,128 @@ func detectResourceName(v any) string {
 	return obj.Metadata.Name
 }
 
-func ensureResource[T any](ctx context.Context, api resourceAPI[T], obj *T) (out *T, err error) {
-	name := detectResourceName(obj)
+// dryRunOption DryRun field of create, patch and delete options
+func dryRunOption(dryRun bool) []string {
+	if dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
 
-	if name == "" {
-		err = errors.New("ensure: missing metadata.name")
+// encodeObject encode obj for server-side apply and rendering, dropping status and creationTimestamp, which are
+// always serialized by typed objects, but never meant to be owned by ezadmis-install
+func encodeObject(obj any) (buf []byte, err error) {
+	if buf, err = json.Marshal(obj); err != nil {
+		return
+	}
+	var m map[string]any
+	if err = json.Unmarshal(buf, &m); err != nil {
 		return
 	}
+	delete(m, "status")
+	if metadata, ok := m["metadata"].(map[string]any); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	return json.Marshal(m)
+}
 
-	if out, err = api.Get(ctx, name, metav1.GetOptions{}); err != nil {
+// upgradeManagedFields migrate fields of existing object, created or updated by earlier versions of
+// ezadmis-install without server-side apply, to the apply manager, so fields no longer rendered are pruned
+// by the next apply, instead of being kept by the old update manager
+func upgradeManagedFields[T any](ctx context.Context, api resourceAPI[T], name string, dryRun bool) (err error) {
+	var current *T
+	if current, err = api.Get(ctx, name, metav1.GetOptions{}); err != nil {
 		if kerrors.IsNotFound(err) {
-			out, err = api.Create(ctx, obj, metav1.CreateOptions{})
+			err = nil
 		}
+		return
+	}
+
+	obj, ok := any(current).(runtime.Object)
+	if !ok {
+		err = fmt.Errorf("upgrade managed fields: %T is not a runtime.Object", current)
+		return
 	}
 
+	var patch []byte
+	if patch, err = csaupgrade.UpgradeManagedFieldsPatch(obj, sets.New(fieldManager), fieldManager); err != nil || patch == nil {
+		return
+	}
+
+	log.Println("upgrading managed fields:", name)
+
+	_, err = api.Patch(ctx, name, types.JSONPatchType, patch, metav1.PatchOptions{
+		DryRun: dryRunOption(dryRun),
+	})
+	return
+}
+
+// applyResource create or update obj with server-side apply, fields owned by other managers are kept,
+// conflicting fields are taken over
+func applyResource[T any](ctx context.Context, api resourceAPI[T], obj *T, dryRun bool) (out *T, err error) {
+	name := detectResourceName(obj)
+
+	if name == "" {
+		err = errors.New("apply: missing metadata.name")
+		return
+	}
+
+	if err = upgradeManagedFields(ctx, api, name, dryRun); err != nil {
+		return
+	}
+
+	var buf []byte
+	if buf, err = encodeObject(obj); err != nil {
+		return
+	}
+
+	force := true
+
+	return api.Patch(ctx, name, types.ApplyPatchType, buf, metav1.PatchOptions{
+		FieldManager: fieldManager,
+		Force:        &force,
+		DryRun:       dryRunOption(dryRun),
+	})
+}
+
+// deleteStaleWebhookConfigurations delete the webhook configuration of the kind not used by opts, left by an earlier
+// install with different 'mutating', or of both kinds if an authorization webhook has no admissionRules, so the API server stops
+// calling the backend through it
+func deleteStaleWebhookConfigurations(ctx context.Context, client kubernetes.Interface, opts Options, dryRun bool) (err error) {
+	defer rg.Guard(&err)
+
+	noRules := len(opts.AdmissionRules) == 0
+
+	if noRules || !opts.Mutating {
+		if rg.Must(deleteResource(ctx, client.AdmissionregistrationV1().MutatingWebhookConfigurations(), qualifiedName(opts), dryRun)) {
+			log.Println("stale mutating webhook configuration deleted:", qualifiedName(opts))
+		}
+	}
+	if noRules || opts.Mutating {
+		if rg.Must(deleteResource(ctx, client.AdmissionregistrationV1().ValidatingWebhookConfigurations(), qualifiedName(opts), dryRun)) {
+			log.Println("stale validating webhook configuration deleted:", qualifiedName(opts))
+		}
+	}
 	return
 }
 
 func ensureCertificate(
 	ctx context.Context,
 	api resourceAPI[corev1.Secret],
+	opts Options,
 	name string,
-	opts x509util.GenerateOptions,
+	generate x509util.GenerateOptions,
+	dryRun bool,
 ) (secret *corev1.Secret, res x509util.PEMPair, err error) {
 	if secret, err = api.Get(ctx, name, metav1.GetOptions{}); err != nil {
 		if kerrors.IsNotFound(err) {
-			if res, err = x509util.Generate(opts); err != nil {
+			if res, err = x509util.Generate(generate); err != nil {
 				return
 			}
 
-			if secret, err = api.Create(ctx, &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: name,
-				},
-				Type: corev1.SecretTypeTLS,
-				StringData: map[string]string{
-					corev1.TLSCertKey:       string(res.Crt),
-					corev1.TLSPrivateKeyKey: string(res.Key),
-				},
-			}, metav1.CreateOptions{}); err != nil {
+			if secret, err = api.Create(ctx, buildCertificateSecret(opts, name, res), metav1.CreateOptions{
+				DryRun: dryRunOption(dryRun),
+			}); err != nil {
 				return
 			}
 		}
@@ -167,9 +329,25 @@ func main() {
 
 	defer rg.Guard(&err)
 
-	var argConf string
+	var (
+		argConf                    string
+		argAuthorizationKubeconfig string
+		argUninstall               bool
+		argRender                  bool
+		argRenderCA                bool
+		argDryRun                  bool
+		argReadyTimeout            time.Duration
+		argVerify                  bool
+	)
 
 	flag.StringVar(&argConf, "conf", "config.json", "config file")
+	flag.StringVar(&argAuthorizationKubeconfig, "authorization-kubeconfig", "", "write kubeconfig for API server '--authorization-webhook-config-file' to this file")
+	flag.BoolVar(&argUninstall, "uninstall", false, "delete webhook configuration, statefulset, service and secrets, instead of installing")
+	flag.BoolVar(&argRender, "render", false, "print manifests as YAML to stdout with certificates generated locally, without accessing the cluster")
+	flag.BoolVar(&argRenderCA, "render-ca", false, "also print the ca secret shared by all webhooks in the namespace with -render, replacing the existing one once applied")
+	flag.BoolVar(&argDryRun, "dry-run", false, "send all requests in server-side dry-run mode, persisting nothing")
+	flag.DurationVar(&argReadyTimeout, "ready-timeout", time.Minute*5, "max duration of waiting for a ready backend, and verifying the webhook, before registering it")
+	flag.BoolVar(&argVerify, "verify", false, "send a synthetic AdmissionReview to the service before registering the webhook, requires network access to the service")
 	flag.Parse()
 
 	bufConf := rg.Must(os.ReadFile(argConf))
@@ -179,8 +357,12 @@ func main() {
 	rg.Must0(json.Unmarshal(bufConf, &opts))
 	rg.Must0(defaults.Set(&opts))
 	rg.Must0(validator.New().Struct(&opts))
+	rg.Must0(validateOptions(opts))
 
-	client := rg.Must(createClient())
+	if argAuthorizationKubeconfig != "" && !opts.Authorization {
+		err = errors.New("-authorization-kubeconfig: requires authorization")
+		return
+	}
 
 	// determine namespace
 	if opts.Namespace == "" {
@@ -192,203 +374,122 @@ func main() {
 		opts.Namespace = metav1.NamespaceDefault
 	}
 
-	log.Println("bootstrapping admission webhook", opts.Name, "in namespace:", opts.Namespace)
+	if argRender {
+		// keep stdout clean for manifests
+		log.SetOutput(os.Stderr)
+
+		ca := rg.Must(render(os.Stdout, opts, argRenderCA))
+
+		if argAuthorizationKubeconfig != "" {
+			rg.Must0(os.WriteFile(argAuthorizationKubeconfig, rg.Must(renderAuthorizationKubeconfig(opts, ca.Crt)), 0600))
+
+			log.Println("authorization webhook kubeconfig written:", argAuthorizationKubeconfig)
+		}
+		return
+	}
+
+	client := rg.Must(createClient())
 
 	ctx := context.Background()
 
+	if argDryRun {
+		log.Println("dry-run mode, nothing will be persisted")
+	}
+
+	if argUninstall {
+		log.Println("uninstalling admission webhook", opts.Name, "in namespace:", opts.Namespace)
+
+		rg.Must0(uninstall(ctx, client, opts, argDryRun))
+		return
+	}
+
+	log.Println("bootstrapping admission webhook", opts.Name, "in namespace:", opts.Namespace)
+
 	_, ca := rg.Must2(
 		ensureCertificate(
 			ctx,
 			client.CoreV1().Secrets(opts.Namespace),
+			opts,
 			ezadmisInstallCA,
-			x509util.GenerateOptions{
-				IsCA:  true,
-				Names: []string{"EZAdmisInstall root ca"},
-			},
+			caGenerateOptions(),
+			argDryRun,
 		),
 	)
 
 	log.Println("ca certificate ensured:", string(ca.Crt))
 
-	secretName := opts.Name + "-crt"
+	if argAuthorizationKubeconfig != "" {
+		rg.Must0(os.WriteFile(argAuthorizationKubeconfig, rg.Must(renderAuthorizationKubeconfig(opts, ca.Crt)), 0600))
+
+		log.Println("authorization webhook kubeconfig written:", argAuthorizationKubeconfig)
+	}
 
 	_, leaf := rg.Must2(
 		ensureCertificate(
 			ctx,
 			client.CoreV1().Secrets(opts.Namespace),
-			secretName,
-			x509util.GenerateOptions{
-				Parent: ca,
-				Names: []string{
-					opts.Name,
-					opts.Name + "." + opts.Namespace,
-					opts.Name + "." + opts.Namespace + ".svc",
-					opts.Name + "." + opts.Namespace + ".svc.cluster",
-					opts.Name + "." + opts.Namespace + ".svc.cluster.local",
-				},
-			},
+			opts,
+			leafSecretName(opts),
+			leafGenerateOptions(opts, ca),
+			argDryRun,
 		),
 	)
 
 	log.Println("leaf certificate ensured:", string(leaf.Crt))
 
-	workloadSelector := map[string]string{
-		"k8s-app": opts.Name,
-	}
+	rg.Must(applyResource(ctx, client.CoreV1().Services(opts.Namespace), buildService(opts), argDryRun))
 
-	rg.Must(ensureResource(
-		ctx,
-		client.CoreV1().Services(opts.Namespace),
-		&corev1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: opts.Name,
-			},
-			Spec: corev1.ServiceSpec{
-				Selector: workloadSelector,
-				Type:     corev1.ServiceTypeClusterIP,
-				Ports: []corev1.ServicePort{
-					{
-						Name:       "https",
-						Protocol:   corev1.ProtocolTCP,
-						Port:       int32(opts.Port),
-						TargetPort: intstr.FromInt(opts.Port),
-					},
-				},
-			},
-		},
-	))
+	log.Println("service applied:", opts.Name)
 
-	log.Println("service ensured:", opts.Name)
+	rg.Must(applyResource(ctx, client.AppsV1().StatefulSets(opts.Namespace), buildStatefulSet(opts), argDryRun))
 
-	const volumeNameTLS = "vol-ezadmis-tls"
+	log.Println("statefulset applied:", opts.Name)
 
-	rg.Must(ensureResource(
-		ctx,
-		client.AppsV1().StatefulSets(opts.Namespace),
-		&appsv1.StatefulSet{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: opts.Name,
-			},
-			Spec: appsv1.StatefulSetSpec{
-				Selector: &metav1.LabelSelector{
-					MatchLabels: workloadSelector,
-				},
-				ServiceName: opts.Name,
-				Template: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: workloadSelector,
-					},
-					Spec: corev1.PodSpec{
-						ImagePullSecrets: opts.ImagePullSecrets,
-						InitContainers:   opts.InitContainers,
-						Affinity:         opts.Affinity,
-						NodeSelector:     opts.NodeSelector,
-						Containers: append([]corev1.Container{
-							{
-								Name:            opts.Name,
-								Image:           opts.Image,
-								ImagePullPolicy: opts.ImagePullPolicy,
-								Command:         opts.Command,
-								Args:            opts.Args,
-								Env:             opts.Env,
-								Ports: []corev1.ContainerPort{
-									{
-										Name:          "https",
-										Protocol:      corev1.ProtocolTCP,
-										ContainerPort: int32(opts.Port),
-									},
-								},
-								VolumeMounts: append([]corev1.VolumeMount{
-									{
-										Name:      volumeNameTLS,
-										SubPath:   corev1.TLSCertKey,
-										MountPath: opts.TLSCrtPath,
-									},
-									{
-										Name:      volumeNameTLS,
-										SubPath:   corev1.TLSPrivateKeyKey,
-										MountPath: opts.TLSKeyPath,
-									},
-								}, opts.VolumeMounts...),
-								Resources: opts.Resources,
-							},
-						}, opts.Containers...),
-						ServiceAccountName: opts.ServiceAccount,
-						Volumes: append([]corev1.Volume{
-							{
-								Name: volumeNameTLS,
-								VolumeSource: corev1.VolumeSource{
-									Secret: &corev1.SecretVolumeSource{
-										SecretName: secretName,
-									},
-								},
-							},
-						}, opts.Volumes...),
-					},
-				},
-			},
-		}),
-	)
+	if len(opts.AdmissionRules) == 0 {
+		log.Println("authorization webhook without admissionRules, skipping validating/mutating webhook")
 
-	log.Println("statefulset ensured:", opts.Name)
+		rg.Must0(deleteStaleWebhookConfigurations(ctx, client, opts, argDryRun))
+		return
+	}
+
+	if !argDryRun {
+		ctx, cancel := context.WithTimeout(ctx, argReadyTimeout)
+		defer cancel()
+
+		log.Println("waiting for ready backend of service:", opts.Name)
+
+		if err = waitForReadyEndpoints(ctx, client, opts); err != nil {
+			err = errors.New("no ready backend of service " + opts.Name + ": " + err.Error())
+			return
+		}
 
-	time.Sleep(time.Second * 10)
+		log.Println("service has ready backend:", opts.Name)
 
-	qualifiedName := opts.Namespace + "-" + opts.Name
+		if argVerify {
+			rg.Must0(verifyWebhook(ctx, client, opts, ca.Crt))
+
+			log.Println("webhook verified with synthetic admission review:", opts.Name)
+		}
+	}
 
 	if opts.Mutating {
-		rg.Must(ensureResource(
+		rg.Must(applyResource(
 			ctx,
 			client.AdmissionregistrationV1().MutatingWebhookConfigurations(),
-			&admissionregistrationv1.MutatingWebhookConfiguration{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: qualifiedName,
-				},
-				Webhooks: []admissionregistrationv1.MutatingWebhook{
-					{
-						Name: qualifiedName + ".ezadmis-install.yankeguo.github.io",
-						ClientConfig: admissionregistrationv1.WebhookClientConfig{
-							CABundle: ca.Crt,
-							Service: &admissionregistrationv1.ServiceReference{
-								Namespace: opts.Namespace,
-								Name:      opts.Name,
-							},
-						},
-						Rules:                   opts.AdmissionRules,
-						SideEffects:             &opts.SideEffects,
-						FailurePolicy:           &opts.FailurePolicy,
-						AdmissionReviewVersions: []string{"v1"},
-					},
-				},
-			},
+			buildMutatingWebhookConfiguration(opts, ca.Crt),
+			argDryRun,
 		))
 	} else {
-		rg.Must(ensureResource(
+		rg.Must(applyResource(
 			ctx,
 			client.AdmissionregistrationV1().ValidatingWebhookConfigurations(),
-			&admissionregistrationv1.ValidatingWebhookConfiguration{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: qualifiedName,
-				},
-				Webhooks: []admissionregistrationv1.ValidatingWebhook{
-					{
-						Name: qualifiedName + ".ezadmis-install.yankeguo.github.io",
-						ClientConfig: admissionregistrationv1.WebhookClientConfig{
-							CABundle: ca.Crt,
-							Service: &admissionregistrationv1.ServiceReference{
-								Namespace: opts.Namespace,
-								Name:      opts.Name,
-							},
-						},
-						Rules:                   opts.AdmissionRules,
-						SideEffects:             &opts.SideEffects,
-						FailurePolicy:           &opts.FailurePolicy,
-						AdmissionReviewVersions: []string{"v1"},
-					},
-				},
-			},
+			buildValidatingWebhookConfiguration(opts, ca.Crt),
+			argDryRun,
 		))
 	}
 
-	log.Println("validating/mutating webhook ensured:", opts.Name)
+	log.Println("validating/mutating webhook applied:", qualifiedName(opts))
+
+	// delete after applying, so there is no gap when switching between mutating and validating
+	rg.Must0(deleteStaleWebhookConfigurations(ctx, client, opts, argDryRun))
 }
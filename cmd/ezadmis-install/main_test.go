@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/creasty/defaults"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+	"github.com/yankeguo/rg"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var testPEMPair = rg.Must(x509util.Generate(caGenerateOptions()))
+
+// testOptions valid options with defaults applied, as loaded from config.json
+func testOptions() Options {
+	opts := Options{
+		Name:      "demo",
+		Namespace: "default",
+		Image:     "example.com/demo:latest",
+		AdmissionRules: []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{""},
+					APIVersions: []string{"v1"},
+					Resources:   []string{"pods"},
+				},
+			},
+		},
+	}
+	rg.Must0(defaults.Set(&opts))
+	return opts
+}
+
+func TestValidateOptions(t *testing.T) {
+	for _, item := range []struct {
+		name   string
+		modify func(opts *Options)
+		err    string
+	}{
+		{
+			name:   "defaults",
+			modify: func(opts *Options) {},
+		},
+		{
+			name:   "missing admission rules",
+			modify: func(opts *Options) { opts.AdmissionRules = nil },
+			err:    "admissionRules: required unless authorization is set",
+		},
+		{
+			name: "authorization without admission rules",
+			modify: func(opts *Options) {
+				opts.AdmissionRules = nil
+				opts.Authorization = true
+				opts.AuthorizationServer = "https://10.96.0.100/authorize"
+			},
+		},
+		{
+			name: "authorization without server",
+			modify: func(opts *Options) {
+				opts.AdmissionRules = nil
+				opts.Authorization = true
+			},
+			err: "authorizationServer: required by authorization webhooks",
+		},
+		{
+			name: "volume mount on tls directory",
+			modify: func(opts *Options) {
+				opts.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/admission-server/"}}
+			},
+			err: `volumeMounts: "/admission-server/" is reserved`,
+		},
+		{
+			name: "volume mount on tls file",
+			modify: func(opts *Options) {
+				opts.TLSCrtPath = "/etc/app/tls.crt"
+				opts.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/etc/app/tls.crt"}}
+			},
+			err: `volumeMounts: "/etc/app/tls.crt" is reserved`,
+		},
+		{
+			name: "volume mount on tls directory with subPath",
+			modify: func(opts *Options) {
+				opts.TLSCrtPath = "/etc/app/tls.crt"
+				opts.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: "/admission-server"}}
+			},
+		},
+		{
+			name: "reinvocation policy of mutating webhook",
+			modify: func(opts *Options) {
+				opts.Mutating = true
+				opts.ReinvocationPolicy = admissionregistrationv1.IfNeededReinvocationPolicy
+			},
+		},
+		{
+			name: "reinvocation policy of validating webhook",
+			modify: func(opts *Options) {
+				opts.ReinvocationPolicy = admissionregistrationv1.IfNeededReinvocationPolicy
+			},
+			err: "reinvocationPolicy: only supported by mutating webhooks",
+		},
+		{
+			name: "selectors",
+			modify: func(opts *Options) {
+				opts.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+				opts.ObjectSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "app", Operator: metav1.LabelSelectorOpExists},
+				}}
+			},
+		},
+		{
+			name: "invalid namespace selector",
+			modify: func(opts *Options) {
+				opts.NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "team", Operator: "Like"},
+				}}
+			},
+			err: "namespaceSelector: ",
+		},
+		{
+			name: "invalid object selector",
+			modify: func(opts *Options) {
+				opts.ObjectSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"bad key!": "a"}}
+			},
+			err: "objectSelector: ",
+		},
+		{
+			name: "match conditions",
+			modify: func(opts *Options) {
+				opts.MatchConditions = []admissionregistrationv1.MatchCondition{
+					{Name: "not-system", Expression: "!request.userInfo.username.startsWith('system:')"},
+					{Name: "example.com/has-labels", Expression: "has(object.metadata.labels)"},
+				}
+			},
+		},
+		{
+			name: "invalid match condition name",
+			modify: func(opts *Options) {
+				opts.MatchConditions = []admissionregistrationv1.MatchCondition{{Name: "Not System!", Expression: "true"}}
+			},
+			err: `matchConditions[0]: invalid name "Not System!"`,
+		},
+		{
+			name: "duplicated match condition name",
+			modify: func(opts *Options) {
+				opts.MatchConditions = []admissionregistrationv1.MatchCondition{
+					{Name: "a", Expression: "true"},
+					{Name: "a", Expression: "false"},
+				}
+			},
+			err: `matchConditions[1]: duplicated name "a"`,
+		},
+		{
+			name: "missing match condition expression",
+			modify: func(opts *Options) {
+				opts.MatchConditions = []admissionregistrationv1.MatchCondition{{Name: "a", Expression: " "}}
+			},
+			err: "matchConditions[0]: missing expression",
+		},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			opts := testOptions()
+			item.modify(&opts)
+			require.NoError(t, validator.New().Struct(&opts))
+
+			err := validateOptions(opts)
+			if item.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, item.err)
+			}
+		})
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	opts := testOptions()
+	require.Equal(t, int32(10), opts.TimeoutSeconds)
+	require.Equal(t, admissionregistrationv1.Equivalent, opts.MatchPolicy)
+	require.Equal(t, admissionregistrationv1.NeverReinvocationPolicy, opts.ReinvocationPolicy)
+	require.Equal(t, []string{"v1"}, opts.AdmissionReviewVersions)
+
+	for _, modify := range []func(opts *Options){
+		func(opts *Options) { opts.TimeoutSeconds = 31 },
+		func(opts *Options) { opts.MatchPolicy = "Fuzzy" },
+		func(opts *Options) { opts.ReinvocationPolicy = "Always" },
+		func(opts *Options) { opts.AdmissionReviewVersions = []string{"v2"} },
+		func(opts *Options) { opts.AdmissionReviewVersions = []string{} },
+	} {
+		opts := testOptions()
+		modify(&opts)
+		require.Error(t, validator.New().Struct(&opts))
+	}
+}
+
+func TestEncodeObject(t *testing.T) {
+	buf, err := encodeObject(buildStatefulSet(testOptions()))
+	require.NoError(t, err)
+
+	var m map[string]any
+	require.NoError(t, json.Unmarshal(buf, &m))
+	require.NotContains(t, m, "status")
+	require.NotContains(t, m["metadata"], "creationTimestamp")
+	require.Equal(t, "demo", m["metadata"].(map[string]any)["name"])
+	require.Contains(t, m, "spec")
+}
+
+func TestApplyResource(t *testing.T) {
+	opts := testOptions()
+	ctx := context.Background()
+
+	client := fake.NewClientset()
+	api := client.CoreV1().Services(opts.Namespace)
+
+	// created by an earlier version without server-side apply, with a label no longer rendered
+	legacy := buildService(opts)
+	legacy.Labels["legacy"] = "true"
+	_, err := api.Create(ctx, legacy, metav1.CreateOptions{FieldManager: fieldManager})
+	require.NoError(t, err)
+
+	out, err := applyResource(ctx, api, buildService(opts), false)
+	require.NoError(t, err)
+	require.Equal(t, managedLabels(), out.Labels)
+
+	current, err := api.Get(ctx, opts.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.NotContains(t, current.Labels, "legacy")
+	require.NotEmpty(t, current.ManagedFields)
+	for _, entry := range current.ManagedFields {
+		require.Equal(t, fieldManager, entry.Manager)
+		require.Equal(t, metav1.ManagedFieldsOperationApply, entry.Operation)
+	}
+
+	// missing object is created
+	_, err = applyResource(ctx, client.AppsV1().StatefulSets(opts.Namespace), buildStatefulSet(opts), false)
+	require.NoError(t, err)
+	_, err = client.AppsV1().StatefulSets(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+}
+
+func TestApplyResourceDryRun(t *testing.T) {
+	opts := testOptions()
+
+	legacy := buildService(opts)
+	legacy.Labels["legacy"] = "true"
+
+	client := fake.NewClientset()
+	_, err := client.CoreV1().Services(opts.Namespace).Create(context.Background(), legacy, metav1.CreateOptions{FieldManager: fieldManager})
+	require.NoError(t, err)
+	client.ClearActions()
+
+	_, err = applyResource(context.Background(), client.CoreV1().Services(opts.Namespace), buildService(opts), true)
+	require.NoError(t, err)
+
+	var patchTypes []types.PatchType
+	for _, action := range client.Actions() {
+		if patch, ok := action.(k8stesting.PatchActionImpl); ok {
+			patchTypes = append(patchTypes, patch.PatchType)
+			require.Equal(t, []string{metav1.DryRunAll}, patch.PatchOptions.DryRun)
+		}
+	}
+	// managed fields upgrade, then apply
+	require.Equal(t, []types.PatchType{types.JSONPatchType, types.ApplyPatchType}, patchTypes)
+}
+
+func TestDeleteStaleWebhookConfigurations(t *testing.T) {
+	rules := []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		},
+	}
+
+	for _, item := range []struct {
+		name       string
+		mutating   bool
+		rules      []admissionregistrationv1.RuleWithOperations
+		mutation   bool
+		validation bool
+	}{
+		{name: "mutating", mutating: true, rules: rules, mutation: true},
+		{name: "validating", rules: rules, validation: true},
+		{name: "authorization without rules", mutating: true},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.Mutating = item.mutating
+			opts.AdmissionRules = item.rules
+			opts.Authorization = len(item.rules) == 0
+
+			ctx := context.Background()
+
+			client := fake.NewClientset(
+				buildMutatingWebhookConfiguration(opts, testPEMPair.Crt),
+				buildValidatingWebhookConfiguration(opts, testPEMPair.Crt),
+			)
+			require.NoError(t, deleteStaleWebhookConfigurations(ctx, client, opts, false))
+
+			_, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, qualifiedName(opts), metav1.GetOptions{})
+			require.Equal(t, item.mutation, err == nil)
+			require.Equal(t, !item.mutation, kerrors.IsNotFound(err))
+
+			_, err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, qualifiedName(opts), metav1.GetOptions{})
+			require.Equal(t, item.validation, err == nil)
+			require.Equal(t, !item.validation, kerrors.IsNotFound(err))
+		})
+	}
+}
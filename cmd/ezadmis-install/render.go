@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io"
+
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+	"github.com/yankeguo/rg"
+	"sigs.k8s.io/yaml"
+)
+
+// render write all manifests ezadmis-install would apply as a multi-document YAML stream to w, with certificates
+// generated locally; the ca is only trusted by the rendered webhook, its secret is left out unless withCA, since
+// applying it replaces the ca shared by other webhooks in the namespace
+func render(w io.Writer, opts Options, withCA bool) (ca x509util.PEMPair, err error) {
+	defer rg.Guard(&err)
+
+	ca = rg.Must(x509util.Generate(caGenerateOptions()))
+	leaf := rg.Must(x509util.Generate(leafGenerateOptions(opts, ca)))
+
+	var objects []any
+
+	if withCA {
+		objects = append(objects, buildCertificateSecret(opts, ezadmisInstallCA, ca))
+	}
+
+	objects = append(objects,
+		buildCertificateSecret(opts, leafSecretName(opts), leaf),
+		buildService(opts),
+		buildStatefulSet(opts),
+	)
+
+	if len(opts.AdmissionRules) != 0 {
+		if opts.Mutating {
+			objects = append(objects, buildMutatingWebhookConfiguration(opts, ca.Crt))
+		} else {
+			objects = append(objects, buildValidatingWebhookConfiguration(opts, ca.Crt))
+		}
+	}
+
+	for i, obj := range objects {
+		if i > 0 {
+			rg.Must(io.WriteString(w, "---\n"))
+		}
+		rg.Must(w.Write(rg.Must(yaml.JSONToYAML(rg.Must(encodeObject(obj))))))
+	}
+
+	return
+}
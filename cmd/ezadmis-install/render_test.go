@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestRender(t *testing.T) {
+	rules := []admissionregistrationv1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Create},
+			Rule: admissionregistrationv1.Rule{
+				APIGroups:   []string{""},
+				APIVersions: []string{"v1"},
+				Resources:   []string{"pods"},
+			},
+		},
+	}
+
+	for _, item := range []struct {
+		name     string
+		mutating bool
+		rules    []admissionregistrationv1.RuleWithOperations
+		withCA   bool
+		objects  []string
+	}{
+		{
+			name:    "without admission rules",
+			objects: []string{"Secret/demo-crt", "Service/demo", "StatefulSet/demo"},
+		},
+		{
+			name:    "with ca",
+			withCA:  true,
+			objects: []string{"Secret/ezadmis-install-ca", "Secret/demo-crt", "Service/demo", "StatefulSet/demo"},
+		},
+		{
+			name:    "validating",
+			rules:   rules,
+			objects: []string{"Secret/demo-crt", "Service/demo", "StatefulSet/demo", "ValidatingWebhookConfiguration/default-demo"},
+		},
+		{
+			name:     "mutating",
+			mutating: true,
+			rules:    rules,
+			objects:  []string{"Secret/demo-crt", "Service/demo", "StatefulSet/demo", "MutatingWebhookConfiguration/default-demo"},
+		},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			opts := testOptions()
+			opts.Mutating = item.mutating
+			opts.AdmissionRules = item.rules
+
+			out := &bytes.Buffer{}
+			ca, err := render(out, opts, item.withCA)
+			require.NoError(t, err)
+
+			var objects []string
+			for _, doc := range strings.Split(out.String(), "---\n") {
+				buf, err := yaml.YAMLToJSON([]byte(doc))
+				require.NoError(t, err)
+
+				var obj struct {
+					metav1.TypeMeta `json:",inline"`
+					Metadata        metav1.ObjectMeta `json:"metadata"`
+					Status          any               `json:"status"`
+					Webhooks        []struct {
+						ClientConfig admissionregistrationv1.WebhookClientConfig `json:"clientConfig"`
+					} `json:"webhooks"`
+				}
+				require.NoError(t, json.Unmarshal(buf, &obj))
+				require.Nil(t, obj.Status)
+				require.Equal(t, fieldManager, obj.Metadata.Labels[labelManagedBy])
+
+				for _, webhook := range obj.Webhooks {
+					require.Equal(t, ca.Crt, webhook.ClientConfig.CABundle)
+				}
+
+				objects = append(objects, obj.Kind+"/"+obj.Metadata.Name)
+			}
+			require.Equal(t, item.objects, objects)
+		})
+	}
+}
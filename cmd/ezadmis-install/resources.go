@@ -0,0 +1,293 @@
+package main
+
+import (
+	"path"
+
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	webhookNameSuffix = ".ezadmis-install.yankeguo.github.io"
+
+	volumeNameTLS = "vol-ezadmis-tls"
+
+	// tlsMountDir dedicated directory of leaf certificate and key, default directory of 'ezadmis' library
+	tlsMountDir = "/admission-server"
+
+	labelManagedBy = "app.kubernetes.io/managed-by"
+)
+
+// managedLabels labels of all resources created by ezadmis-install
+func managedLabels() map[string]string {
+	return map[string]string{
+		labelManagedBy: fieldManager,
+	}
+}
+
+// isManaged whether labels mark a resource created by ezadmis-install
+func isManaged(labels map[string]string) bool {
+	return labels[labelManagedBy] == fieldManager
+}
+
+// leafSecretName name of the Secret holding leaf certificate of the webhook
+func leafSecretName(opts Options) string {
+	return opts.Name + "-crt"
+}
+
+// qualifiedName name of the webhook configuration
+func qualifiedName(opts Options) string {
+	return opts.Namespace + "-" + opts.Name
+}
+
+// caGenerateOptions options for generating the ca shared by all webhooks in a namespace
+func caGenerateOptions() x509util.GenerateOptions {
+	return x509util.GenerateOptions{
+		IsCA:  true,
+		Names: []string{"EZAdmisInstall root ca"},
+	}
+}
+
+// leafGenerateOptions options for generating leaf certificate of the webhook, valid for all DNS names of the service
+func leafGenerateOptions(opts Options, ca x509util.PEMPair) x509util.GenerateOptions {
+	return x509util.GenerateOptions{
+		Parent: ca,
+		Names: []string{
+			opts.Name,
+			opts.Name + "." + opts.Namespace,
+			opts.Name + "." + opts.Namespace + ".svc",
+			opts.Name + "." + opts.Namespace + ".svc.cluster",
+			opts.Name + "." + opts.Namespace + ".svc.cluster.local",
+		},
+	}
+}
+
+func buildCertificateSecret(opts Options, name string, pair x509util.PEMPair) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+			Labels:    managedLabels(),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pair.Crt,
+			corev1.TLSPrivateKeyKey: pair.Key,
+		},
+	}
+}
+
+func workloadSelector(opts Options) map[string]string {
+	return map[string]string{
+		"k8s-app": opts.Name,
+	}
+}
+
+func buildService(opts Options) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    managedLabels(),
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: workloadSelector(opts),
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "https",
+					Protocol:   corev1.ProtocolTCP,
+					Port:       int32(opts.Port),
+					TargetPort: intstr.FromInt(opts.Port),
+				},
+			},
+		},
+	}
+}
+
+// buildTLSVolumes build volume and mounts of leaf certificate secret; if both certificate and key are placed in
+// tlsMountDir, the secret is mounted as that directory, so kubelet updates files when the secret changes,
+// otherwise files are mounted with subPath, never updated, not to hide other files in their directories
+func buildTLSVolumes(opts Options) (volumes []corev1.Volume, mounts []corev1.VolumeMount) {
+	source := &corev1.SecretVolumeSource{
+		SecretName: leafSecretName(opts),
+	}
+	volumes = []corev1.Volume{
+		{
+			Name:         volumeNameTLS,
+			VolumeSource: corev1.VolumeSource{Secret: source},
+		},
+	}
+
+	if isTLSReloadable(opts) {
+		source.Items = []corev1.KeyToPath{
+			{Key: corev1.TLSCertKey, Path: path.Base(opts.TLSCrtPath)},
+			{Key: corev1.TLSPrivateKeyKey, Path: path.Base(opts.TLSKeyPath)},
+		}
+		mounts = []corev1.VolumeMount{
+			{
+				Name:      volumeNameTLS,
+				MountPath: tlsMountDir,
+				ReadOnly:  true,
+			},
+		}
+		return
+	}
+
+	mounts = []corev1.VolumeMount{
+		{
+			Name:      volumeNameTLS,
+			SubPath:   corev1.TLSCertKey,
+			MountPath: opts.TLSCrtPath,
+			ReadOnly:  true,
+		},
+		{
+			Name:      volumeNameTLS,
+			SubPath:   corev1.TLSPrivateKeyKey,
+			MountPath: opts.TLSKeyPath,
+			ReadOnly:  true,
+		},
+	}
+	return
+}
+
+// isTLSReloadable whether certificate and key are both placed in tlsMountDir, thus mounted as a directory
+// and updated by kubelet when the secret changes
+func isTLSReloadable(opts Options) bool {
+	return path.Dir(path.Clean(opts.TLSCrtPath)) == tlsMountDir && path.Dir(path.Clean(opts.TLSKeyPath)) == tlsMountDir
+}
+
+func buildStatefulSet(opts Options) *appsv1.StatefulSet {
+	tlsVolumes, tlsVolumeMounts := buildTLSVolumes(opts)
+
+	return &appsv1.StatefulSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "StatefulSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    managedLabels(),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: workloadSelector(opts),
+			},
+			ServiceName: opts.Name,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: workloadSelector(opts),
+				},
+				Spec: corev1.PodSpec{
+					ImagePullSecrets: opts.ImagePullSecrets,
+					InitContainers:   opts.InitContainers,
+					Affinity:         opts.Affinity,
+					NodeSelector:     opts.NodeSelector,
+					Containers: append([]corev1.Container{
+						{
+							Name:            opts.Name,
+							Image:           opts.Image,
+							ImagePullPolicy: opts.ImagePullPolicy,
+							Command:         opts.Command,
+							Args:            opts.Args,
+							Env:             opts.Env,
+							Ports: []corev1.ContainerPort{
+								{
+									Name:          "https",
+									Protocol:      corev1.ProtocolTCP,
+									ContainerPort: int32(opts.Port),
+								},
+							},
+							VolumeMounts:   append(tlsVolumeMounts, opts.VolumeMounts...),
+							Resources:      opts.Resources,
+							ReadinessProbe: createProbe(opts, "/readyz"),
+							LivenessProbe:  createProbe(opts, "/healthz"),
+						},
+					}, opts.Containers...),
+					ServiceAccountName: opts.ServiceAccount,
+					Volumes:            append(tlsVolumes, opts.Volumes...),
+				},
+			},
+		},
+	}
+}
+
+func buildWebhookClientConfig(opts Options, caCrt []byte) admissionregistrationv1.WebhookClientConfig {
+	return admissionregistrationv1.WebhookClientConfig{
+		CABundle: caCrt,
+		Service: &admissionregistrationv1.ServiceReference{
+			Namespace: opts.Namespace,
+			Name:      opts.Name,
+		},
+	}
+}
+
+func buildMutatingWebhookConfiguration(opts Options, caCrt []byte) *admissionregistrationv1.MutatingWebhookConfiguration {
+	return &admissionregistrationv1.MutatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "MutatingWebhookConfiguration",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   qualifiedName(opts),
+			Labels: managedLabels(),
+		},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:                    qualifiedName(opts) + webhookNameSuffix,
+				ClientConfig:            buildWebhookClientConfig(opts, caCrt),
+				Rules:                   opts.AdmissionRules,
+				SideEffects:             &opts.SideEffects,
+				FailurePolicy:           &opts.FailurePolicy,
+				NamespaceSelector:       opts.NamespaceSelector,
+				ObjectSelector:          opts.ObjectSelector,
+				TimeoutSeconds:          &opts.TimeoutSeconds,
+				MatchPolicy:             &opts.MatchPolicy,
+				ReinvocationPolicy:      &opts.ReinvocationPolicy,
+				MatchConditions:         opts.MatchConditions,
+				AdmissionReviewVersions: opts.AdmissionReviewVersions,
+			},
+		},
+	}
+}
+
+func buildValidatingWebhookConfiguration(opts Options, caCrt []byte) *admissionregistrationv1.ValidatingWebhookConfiguration {
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionregistrationv1.SchemeGroupVersion.String(),
+			Kind:       "ValidatingWebhookConfiguration",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   qualifiedName(opts),
+			Labels: managedLabels(),
+		},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name:                    qualifiedName(opts) + webhookNameSuffix,
+				ClientConfig:            buildWebhookClientConfig(opts, caCrt),
+				Rules:                   opts.AdmissionRules,
+				SideEffects:             &opts.SideEffects,
+				FailurePolicy:           &opts.FailurePolicy,
+				NamespaceSelector:       opts.NamespaceSelector,
+				ObjectSelector:          opts.ObjectSelector,
+				TimeoutSeconds:          &opts.TimeoutSeconds,
+				MatchPolicy:             &opts.MatchPolicy,
+				MatchConditions:         opts.MatchConditions,
+				AdmissionReviewVersions: opts.AdmissionReviewVersions,
+			},
+		},
+	}
+}
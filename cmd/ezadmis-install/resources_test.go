@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestBuildTLSVolumes(t *testing.T) {
+	// default paths, mounted as the dedicated directory
+	opts := testOptions()
+	volumes, mounts := buildTLSVolumes(opts)
+	require.Len(t, volumes, 1)
+	require.Equal(t, []corev1.KeyToPath{
+		{Key: corev1.TLSCertKey, Path: "tls.crt"},
+		{Key: corev1.TLSPrivateKeyKey, Path: "tls.key"},
+	}, volumes[0].Secret.Items)
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: volumeNameTLS, MountPath: tlsMountDir, ReadOnly: true},
+	}, mounts)
+
+	// custom file names in the dedicated directory
+	opts.TLSCrtPath, opts.TLSKeyPath = "/admission-server/server.pem", "/admission-server/server-key.pem"
+	volumes, mounts = buildTLSVolumes(opts)
+	require.Equal(t, "server.pem", volumes[0].Secret.Items[0].Path)
+	require.Equal(t, "server-key.pem", volumes[0].Secret.Items[1].Path)
+	require.Equal(t, tlsMountDir, mounts[0].MountPath)
+
+	// elsewhere, mounted as single files, not hiding the directory
+	opts.TLSCrtPath, opts.TLSKeyPath = "/etc/app/tls.crt", "/etc/app/tls.key"
+	volumes, mounts = buildTLSVolumes(opts)
+	require.Len(t, volumes, 1)
+	require.Nil(t, volumes[0].Secret.Items)
+	require.Equal(t, []corev1.VolumeMount{
+		{Name: volumeNameTLS, SubPath: corev1.TLSCertKey, MountPath: "/etc/app/tls.crt", ReadOnly: true},
+		{Name: volumeNameTLS, SubPath: corev1.TLSPrivateKeyKey, MountPath: "/etc/app/tls.key", ReadOnly: true},
+	}, mounts)
+}
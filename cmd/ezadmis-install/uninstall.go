@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/yankeguo/rg"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type deletableAPI interface {
+	Delete(ctx context.Context, name string, opts metav1.DeleteOptions) error
+}
+
+// deleteResource delete resource by name, missing resource is not an error
+func deleteResource(ctx context.Context, api deletableAPI, name string, dryRun bool) (deleted bool, err error) {
+	propagation := metav1.DeletePropagationBackground
+
+	if err = api.Delete(ctx, name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		DryRun:            dryRunOption(dryRun),
+	}); err != nil {
+		if kerrors.IsNotFound(err) {
+			err = nil
+		}
+		return
+	}
+	deleted = true
+	return
+}
+
+// referencesNamespace whether the webhook is installed by ezadmis-install, and served by a service in namespace,
+// thus trusting the ca in namespace
+func referencesNamespace(name string, cfg admissionregistrationv1.WebhookClientConfig, namespace string) bool {
+	return strings.HasSuffix(name, webhookNameSuffix) && cfg.Service != nil && cfg.Service.Namespace == namespace
+}
+
+// isLeafSecret whether secret is a leaf certificate created by ezadmis-install, signed by the ca in its namespace;
+// secrets created before labeling are recognized by type and name
+func isLeafSecret(secret corev1.Secret) bool {
+	if secret.Name == ezadmisInstallCA {
+		return false
+	}
+	if isManaged(secret.Labels) {
+		return true
+	}
+	return secret.Labels[labelManagedBy] == "" && secret.Type == corev1.SecretTypeTLS && strings.HasSuffix(secret.Name, "-crt")
+}
+
+// isCAReferenced whether anything installed by ezadmis-install, other than the webhook of opts, still trusts the ca
+// in namespace of opts, including webhook configurations, statefulsets and leaf certificate secrets, the latter two
+// also cover authorization webhooks, which have no webhook configuration
+func isCAReferenced(ctx context.Context, client kubernetes.Interface, opts Options) (referenced bool, err error) {
+	defer rg.Guard(&err)
+
+	for _, item := range rg.Must(client.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})).Items {
+		if item.Name == qualifiedName(opts) {
+			continue
+		}
+		for _, webhook := range item.Webhooks {
+			if referencesNamespace(webhook.Name, webhook.ClientConfig, opts.Namespace) {
+				log.Println("ca still referenced by mutating webhook configuration:", item.Name)
+				return true, nil
+			}
+		}
+	}
+
+	for _, item := range rg.Must(client.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})).Items {
+		if item.Name == qualifiedName(opts) {
+			continue
+		}
+		for _, webhook := range item.Webhooks {
+			if referencesNamespace(webhook.Name, webhook.ClientConfig, opts.Namespace) {
+				log.Println("ca still referenced by validating webhook configuration:", item.Name)
+				return true, nil
+			}
+		}
+	}
+
+	for _, item := range rg.Must(client.AppsV1().StatefulSets(opts.Namespace).List(ctx, metav1.ListOptions{})).Items {
+		if item.Name == opts.Name || !isManaged(item.Labels) {
+			continue
+		}
+		log.Println("ca still referenced by statefulset:", item.Name)
+		return true, nil
+	}
+
+	for _, item := range rg.Must(client.CoreV1().Secrets(opts.Namespace).List(ctx, metav1.ListOptions{})).Items {
+		if item.Name == leafSecretName(opts) || !isLeafSecret(item) {
+			continue
+		}
+		log.Println("ca still referenced by leaf certificate secret:", item.Name)
+		return true, nil
+	}
+
+	return
+}
+
+// uninstall delete everything created by ezadmis-install, webhook configuration first, so a failed uninstall
+// never leaves a webhook without backend
+func uninstall(ctx context.Context, client kubernetes.Interface, opts Options, dryRun bool) (err error) {
+	defer rg.Guard(&err)
+
+	report := func(kind string, name string, deleted bool) {
+		if deleted {
+			log.Println(kind, "deleted:", name)
+		} else {
+			log.Println(kind, "not found:", name)
+		}
+	}
+
+	report(
+		"mutating webhook configuration", qualifiedName(opts),
+		rg.Must(deleteResource(ctx, client.AdmissionregistrationV1().MutatingWebhookConfigurations(), qualifiedName(opts), dryRun)),
+	)
+	report(
+		"validating webhook configuration", qualifiedName(opts),
+		rg.Must(deleteResource(ctx, client.AdmissionregistrationV1().ValidatingWebhookConfigurations(), qualifiedName(opts), dryRun)),
+	)
+	report(
+		"statefulset", opts.Name,
+		rg.Must(deleteResource(ctx, client.AppsV1().StatefulSets(opts.Namespace), opts.Name, dryRun)),
+	)
+	report(
+		"service", opts.Name,
+		rg.Must(deleteResource(ctx, client.CoreV1().Services(opts.Namespace), opts.Name, dryRun)),
+	)
+	report(
+		"secret", leafSecretName(opts),
+		rg.Must(deleteResource(ctx, client.CoreV1().Secrets(opts.Namespace), leafSecretName(opts), dryRun)),
+	)
+
+	referenced, err := isCAReferenced(ctx, client, opts)
+	if kerrors.IsForbidden(err) {
+		log.Println("keeping ca secret:", ezadmisInstallCA, "unable to tell whether it's still used:", err.Error())
+		return nil
+	}
+	if rg.Must(referenced, err) {
+		log.Println("keeping ca secret:", ezadmisInstallCA)
+		return
+	}
+
+	report(
+		"secret", ezadmisInstallCA,
+		rg.Must(deleteResource(ctx, client.CoreV1().Secrets(opts.Namespace), ezadmisInstallCA, dryRun)),
+	)
+
+	return
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testInstalledObjects(opts Options) []runtime.Object {
+	return []runtime.Object{
+		buildCertificateSecret(opts, ezadmisInstallCA, testPEMPair),
+		buildCertificateSecret(opts, leafSecretName(opts), testPEMPair),
+		buildService(opts),
+		buildStatefulSet(opts),
+		buildValidatingWebhookConfiguration(opts, testPEMPair.Crt),
+	}
+}
+
+func TestIsCAReferenced(t *testing.T) {
+	opts := testOptions()
+	other := testOptions()
+	other.Name = "other"
+
+	for _, item := range []struct {
+		name       string
+		objects    []runtime.Object
+		referenced bool
+	}{
+		{
+			name:    "only itself",
+			objects: testInstalledObjects(opts),
+		},
+		{
+			name:       "other webhook configuration",
+			objects:    append(testInstalledObjects(opts), buildMutatingWebhookConfiguration(other, testPEMPair.Crt)),
+			referenced: true,
+		},
+		{
+			name:       "other statefulset",
+			objects:    append(testInstalledObjects(opts), buildStatefulSet(other)),
+			referenced: true,
+		},
+		{
+			name:       "other leaf secret",
+			objects:    append(testInstalledObjects(opts), buildCertificateSecret(other, leafSecretName(other), testPEMPair)),
+			referenced: true,
+		},
+		{
+			name: "unlabeled leaf secret",
+			objects: append(testInstalledObjects(opts), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "legacy-crt", Namespace: opts.Namespace},
+				Type:       corev1.SecretTypeTLS,
+			}),
+			referenced: true,
+		},
+		{
+			name: "unrelated objects",
+			objects: append(testInstalledObjects(opts),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: opts.Namespace},
+					Type:       corev1.SecretTypeOpaque,
+				},
+				&appsv1.StatefulSet{
+					ObjectMeta: metav1.ObjectMeta{Name: "database", Namespace: opts.Namespace},
+				},
+				buildStatefulSet(Options{Name: "other", Namespace: "elsewhere"}),
+			),
+		},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			client := fake.NewClientset(item.objects...)
+			referenced, err := isCAReferenced(context.Background(), client, opts)
+			require.NoError(t, err)
+			require.Equal(t, item.referenced, referenced)
+		})
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	opts := testOptions()
+	other := testOptions()
+	other.Name = "other"
+
+	client := fake.NewClientset(append(testInstalledObjects(opts), buildStatefulSet(other))...)
+	require.NoError(t, uninstall(context.Background(), client, opts, false))
+
+	ctx := context.Background()
+
+	_, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, qualifiedName(opts), metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+	_, err = client.AppsV1().StatefulSets(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+	_, err = client.CoreV1().Services(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+	_, err = client.CoreV1().Secrets(opts.Namespace).Get(ctx, leafSecretName(opts), metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+
+	// kept for the other webhook
+	_, err = client.CoreV1().Secrets(opts.Namespace).Get(ctx, ezadmisInstallCA, metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, client.AppsV1().StatefulSets(opts.Namespace).Delete(ctx, other.Name, metav1.DeleteOptions{}))
+
+	// safe to run again, the ca is deleted once unused
+	require.NoError(t, uninstall(ctx, client, opts, false))
+	_, err = client.CoreV1().Secrets(opts.Namespace).Get(ctx, ezadmisInstallCA, metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+}
+
+func TestUninstallListForbidden(t *testing.T) {
+	opts := testOptions()
+
+	client := fake.NewClientset(testInstalledObjects(opts)...)
+	client.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		resource := action.GetResource()
+		return true, nil, kerrors.NewForbidden(schema.GroupResource{Group: resource.Group, Resource: resource.Resource}, "", nil)
+	})
+
+	ctx := context.Background()
+
+	require.NoError(t, uninstall(ctx, client, opts, false))
+
+	_, err := client.AppsV1().StatefulSets(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+	_, err = client.CoreV1().Secrets(opts.Namespace).Get(ctx, leafSecretName(opts), metav1.GetOptions{})
+	require.True(t, kerrors.IsNotFound(err))
+
+	// kept, since whether it's still used can not be told
+	_, err = client.CoreV1().Secrets(opts.Namespace).Get(ctx, ezadmisInstallCA, metav1.GetOptions{})
+	require.NoError(t, err)
+}
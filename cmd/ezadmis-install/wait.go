@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+const waitInterval = time.Second * 2
+
+// waitForReadyEndpoints wait until the service of the webhook has at least one ready endpoint
+func waitForReadyEndpoints(ctx context.Context, client kubernetes.Interface, opts Options) error {
+	return wait.PollUntilContextCancel(ctx, waitInterval, true, func(ctx context.Context) (bool, error) {
+		endpointSlices, err := client.DiscoveryV1().EndpointSlices(opts.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: discoveryv1.LabelServiceName + "=" + opts.Name,
+		})
+		if err != nil {
+			log.Println("failed to list endpointslices:", err.Error())
+			return false, nil
+		}
+		for _, slice := range endpointSlices.Items {
+			for _, endpoint := range slice.Endpoints {
+				// nil means ready
+				if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	})
+}
+
+// dialWebhook dial function of verifyWebhook, replaced in tests
+var dialWebhook func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// syntheticName name of the object in synthetic AdmissionReview
+const syntheticName = fieldManager + "-verify"
+
+// matchRule whether value is matched by rule, a list of values or '*'
+func matchRule(rule []string, value string) bool {
+	return slices.Contains(rule, "*") || slices.Contains(rule, value)
+}
+
+// buildSyntheticReview build a dry-run AdmissionReview matching the first of opts.AdmissionRules, the kind of its
+// resource is resolved with discovery, the object carries nothing but apiVersion, kind and metadata
+func buildSyntheticReview(dc discovery.DiscoveryInterface, opts Options) (review admissionv1.AdmissionReview, err error) {
+	if len(opts.AdmissionRules) == 0 {
+		err = errors.New("no admissionRules to build synthetic AdmissionReview from")
+		return
+	}
+	rule := opts.AdmissionRules[0]
+
+	var lists []*metav1.APIResourceList
+	if _, lists, err = dc.ServerGroupsAndResources(); err != nil {
+		// partial results of failed groups are still usable
+		if len(lists) == 0 {
+			err = errors.New("failed to discover resources: " + err.Error())
+			return
+		}
+		err = nil
+	}
+
+	var (
+		gv       schema.GroupVersion
+		resource metav1.APIResource
+		found    bool
+	)
+
+	for _, list := range lists {
+		if gv, err = schema.ParseGroupVersion(list.GroupVersion); err != nil {
+			return
+		}
+		if !matchRule(rule.APIGroups, gv.Group) || !matchRule(rule.APIVersions, gv.Version) {
+			continue
+		}
+		for _, item := range list.APIResources {
+			if strings.Contains(item.Name, "/") || !matchRule(rule.Resources, item.Name) {
+				continue
+			}
+			if rule.Scope != nil && *rule.Scope != admissionregistrationv1.AllScopes &&
+				(*rule.Scope == admissionregistrationv1.NamespacedScope) != item.Namespaced {
+				continue
+			}
+			resource, found = item, true
+			break
+		}
+		if found {
+			break
+		}
+	}
+
+	if !found {
+		err = errors.New("no resource discovered matching the first of admissionRules")
+		return
+	}
+
+	operation := admissionv1.Create
+	if len(rule.Operations) != 0 && rule.Operations[0] != admissionregistrationv1.OperationAll {
+		operation = admissionv1.Operation(rule.Operations[0])
+	}
+
+	namespace := ""
+	if resource.Namespaced {
+		namespace = opts.Namespace
+	}
+
+	var raw []byte
+	if raw, err = json.Marshal(map[string]any{
+		"apiVersion": gv.String(),
+		"kind":       resource.Kind,
+		"metadata": map[string]any{
+			"name":      syntheticName,
+			"namespace": namespace,
+		},
+	}); err != nil {
+		return
+	}
+
+	dryRun := true
+
+	review = admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       uuid.NewUUID(),
+			Kind:      metav1.GroupVersionKind{Group: gv.Group, Version: gv.Version, Kind: resource.Kind},
+			Resource:  metav1.GroupVersionResource{Group: gv.Group, Version: gv.Version, Resource: resource.Name},
+			Name:      syntheticName,
+			Namespace: namespace,
+			Operation: operation,
+			DryRun:    &dryRun,
+		},
+	}
+	review.Request.RequestKind = &review.Request.Kind
+	review.Request.RequestResource = &review.Request.Resource
+
+	// object is absent for DELETE, old object is only present for UPDATE and DELETE
+	if operation != admissionv1.Delete {
+		review.Request.Object.Raw = raw
+	}
+	if operation == admissionv1.Update || operation == admissionv1.Delete {
+		review.Request.OldObject.Raw = raw
+	}
+	return
+}
+
+// verifyWebhook send a synthetic AdmissionReview, built from the first of opts.AdmissionRules, to the service of
+// the webhook, trusting only caCrt, succeeds once a well-formed AdmissionReview response is received, no matter
+// allowed or denied; any response other than HTTP 200 is a failure, and retried until ctx is done
+func verifyWebhook(ctx context.Context, client kubernetes.Interface, opts Options, caCrt []byte) error {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCrt) {
+		return errors.New("verify: invalid ca certificate")
+	}
+
+	review, err := buildSyntheticReview(client.Discovery(), opts)
+	if err != nil {
+		return errors.New("verify: " + err.Error())
+	}
+
+	host := opts.Name + "." + opts.Namespace + ".svc"
+
+	httpClient := &http.Client{
+		Timeout: time.Second * 10,
+		Transport: &http.Transport{
+			DialContext: dialWebhook,
+			TLSClientConfig: &tls.Config{
+				RootCAs:    pool,
+				ServerName: host,
+			},
+		},
+	}
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return err
+	}
+
+	url := "https://" + host + ":" + strconv.Itoa(opts.Port) + "/"
+
+	var lastErr error
+
+	if err = wait.PollUntilContextCancel(ctx, waitInterval, true, func(ctx context.Context) (bool, error) {
+		if lastErr = sendAdmissionReview(ctx, httpClient, url, body, review.Request.UID); lastErr != nil {
+			log.Println("synthetic admission review failed:", lastErr.Error())
+			return false, nil
+		}
+		return true, nil
+	}); err != nil && lastErr != nil {
+		err = fmt.Errorf("verify: %w: %w", err, lastErr)
+	}
+	return err
+}
+
+// sendAdmissionReview post body to url, and check the AdmissionReview response has uid
+func sendAdmissionReview(ctx context.Context, client *http.Client, url string, body []byte, uid types.UID) (err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var res *http.Response
+	if res, err = client.Do(req); err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	var buf []byte
+	if buf, err = io.ReadAll(res.Body); err != nil {
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status code %d: %s", res.StatusCode, string(buf))
+		return
+	}
+
+	var review admissionv1.AdmissionReview
+	if err = json.Unmarshal(buf, &review); err != nil {
+		err = errors.New("invalid AdmissionReview response: " + err.Error())
+		return
+	}
+	if review.Response == nil || review.Response.UID != uid {
+		err = errors.New("AdmissionReview response missing or with mismatched uid")
+		return
+	}
+	return
+}
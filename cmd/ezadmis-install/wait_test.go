@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis"
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWaitForReadyEndpoints(t *testing.T) {
+	opts := testOptions()
+
+	slice := func(service string, ready *bool) *discoveryv1.EndpointSlice {
+		return &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      service + "-abcde",
+				Namespace: opts.Namespace,
+				Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+			},
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses:  []string{"10.0.0.1"},
+					Conditions: discoveryv1.EndpointConditions{Ready: ready},
+				},
+			},
+		}
+	}
+
+	ready, notReady := true, false
+
+	for _, item := range []struct {
+		name    string
+		objects []runtime.Object
+		ready   bool
+	}{
+		{name: "ready", objects: []runtime.Object{slice(opts.Name, &ready)}, ready: true},
+		{name: "nil condition", objects: []runtime.Object{slice(opts.Name, nil)}, ready: true},
+		{name: "not ready", objects: []runtime.Object{slice(opts.Name, &notReady)}},
+		{name: "other service", objects: []runtime.Object{slice("other", &ready)}},
+		{name: "no endpointslice"},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+			defer cancel()
+
+			err := waitForReadyEndpoints(ctx, fake.NewClientset(item.objects...), opts)
+			if item.ready {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestSendAdmissionReview(t *testing.T) {
+	var status int
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if status != http.StatusOK {
+			http.Error(rw, "failed", status)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		buf, _ := io.ReadAll(req.Body)
+		_ = json.Unmarshal(buf, &review)
+		review.Response = &admissionv1.AdmissionResponse{UID: review.Request.UID}
+		review.Request = nil
+		_ = json.NewEncoder(rw).Encode(review)
+	}))
+	defer s.Close()
+
+	send := func(client *http.Client, uid types.UID) error {
+		body, err := json.Marshal(admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: uid}})
+		require.NoError(t, err)
+		return sendAdmissionReview(context.Background(), client, s.URL, body, "test-uid")
+	}
+
+	status = http.StatusOK
+	require.NoError(t, send(s.Client(), "test-uid"))
+	require.ErrorContains(t, send(s.Client(), "other-uid"), "mismatched uid")
+
+	// not trusting the certificate of the server
+	require.Error(t, send(http.DefaultClient, "test-uid"))
+
+	status = http.StatusInternalServerError
+	require.ErrorContains(t, send(s.Client(), "test-uid"), "unexpected status code 500")
+
+	status = http.StatusNotFound
+	require.ErrorContains(t, send(s.Client(), "test-uid"), "unexpected status code 404")
+}
+
+// testDiscoveryResources resources served by the fake API server for synthetic AdmissionReview
+var testDiscoveryResources = []*metav1.APIResourceList{
+	{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{
+			{Name: "namespaces", Kind: "Namespace"},
+			{Name: "pods", Kind: "Pod", Namespaced: true},
+			{Name: "pods/status", Kind: "Pod", Namespaced: true},
+		},
+	},
+	{
+		GroupVersion: "apps/v1",
+		APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true},
+		},
+	},
+}
+
+func TestBuildSyntheticReview(t *testing.T) {
+	client := fake.NewClientset()
+	client.Resources = testDiscoveryResources
+
+	rule := func(groups, versions, resources []string, operation admissionregistrationv1.OperationType) []admissionregistrationv1.RuleWithOperations {
+		return []admissionregistrationv1.RuleWithOperations{
+			{
+				Operations: []admissionregistrationv1.OperationType{operation},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   groups,
+					APIVersions: versions,
+					Resources:   resources,
+				},
+			},
+		}
+	}
+
+	opts := testOptions()
+
+	review, err := buildSyntheticReview(client.Discovery(), opts)
+	require.NoError(t, err)
+	require.Equal(t, metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}, review.Request.Kind)
+	require.Equal(t, metav1.GroupVersionResource{Version: "v1", Resource: "pods"}, review.Request.Resource)
+	require.Equal(t, admissionv1.Create, review.Request.Operation)
+	require.Equal(t, opts.Namespace, review.Request.Namespace)
+	require.True(t, *review.Request.DryRun)
+	require.Nil(t, review.Request.OldObject.Raw)
+
+	var pod corev1.Pod
+	require.NoError(t, json.Unmarshal(review.Request.Object.Raw, &pod))
+	require.Equal(t, "Pod", pod.Kind)
+	require.Equal(t, syntheticName, pod.Name)
+	require.Equal(t, opts.Namespace, pod.Namespace)
+
+	opts.AdmissionRules = rule([]string{"apps"}, []string{"*"}, []string{"*"}, admissionregistrationv1.Delete)
+	review, err = buildSyntheticReview(client.Discovery(), opts)
+	require.NoError(t, err)
+	require.Equal(t, metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, review.Request.Kind)
+	require.Equal(t, admissionv1.Delete, review.Request.Operation)
+	require.Nil(t, review.Request.Object.Raw)
+	require.NotNil(t, review.Request.OldObject.Raw)
+
+	opts.AdmissionRules = rule([]string{""}, []string{"v1"}, []string{"namespaces"}, admissionregistrationv1.OperationAll)
+	review, err = buildSyntheticReview(client.Discovery(), opts)
+	require.NoError(t, err)
+	require.Equal(t, "Namespace", review.Request.Kind.Kind)
+	require.Equal(t, admissionv1.Create, review.Request.Operation)
+	require.Empty(t, review.Request.Namespace)
+
+	opts.AdmissionRules = rule([]string{"example.com"}, []string{"v1"}, []string{"foos"}, admissionregistrationv1.Create)
+	_, err = buildSyntheticReview(client.Discovery(), opts)
+	require.ErrorContains(t, err, "no resource discovered")
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	opts := testOptions()
+
+	client := fake.NewClientset()
+	client.Resources = testDiscoveryResources
+
+	leaf, err := x509util.Generate(leafGenerateOptions(opts, testPEMPair))
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(leaf.Crt, leaf.Key)
+	require.NoError(t, err)
+
+	var failing bool
+
+	s := httptest.NewUnstartedServer(ezadmis.WrapWebhookHandler(ezadmis.WrapWebhookHandlerOptions{}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw ezadmis.WebhookResponseWriter) (err error) {
+		if failing {
+			return errors.New("boom")
+		}
+		var pod corev1.Pod
+		if err = json.Unmarshal(req.Object.Raw, &pod); err != nil {
+			return
+		}
+		if pod.Kind != "Pod" || req.Resource.Resource != "pods" || req.DryRun == nil || !*req.DryRun {
+			return errors.New("unexpected synthetic request")
+		}
+		rw.Deny("denied, but verified")
+		return
+	}))
+	s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	s.StartTLS()
+	defer s.Close()
+
+	// redirect service DNS name to the test server
+	dialWebhook = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, s.Listener.Addr().String())
+	}
+	defer func() { dialWebhook = nil }()
+
+	require.NoError(t, verifyWebhook(context.Background(), client, opts, testPEMPair.Crt))
+
+	// handler failing on every request never passes
+	failing = true
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	require.ErrorContains(t, verifyWebhook(ctx, client, opts, testPEMPair.Crt), "unexpected status code 500")
+
+	// not trusting any other ca
+	failing = false
+	other, err := x509util.Generate(caGenerateOptions())
+	require.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	require.ErrorContains(t, verifyWebhook(ctx, client, opts, other.Crt), "certificate")
+}
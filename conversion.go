@@ -0,0 +1,263 @@
+package ezadmis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ConversionReviewAPIVersion apiVersion of ConversionReview
+const ConversionReviewAPIVersion = "apiextensions.k8s.io/v1"
+
+// ErrMissingConversionRequest ConversionReview has no request, responded with HTTP 400
+var ErrMissingConversionRequest = errors.New("missing request in ConversionReview")
+
+// ConversionReview ConversionReview of apiextensions.k8s.io/v1, defined here to avoid depending on
+// k8s.io/apiextensions-apiserver
+type ConversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *ConversionRequest  `json:"request,omitempty"`
+	Response        *ConversionResponse `json:"response,omitempty"`
+}
+
+// ConversionRequest request of ConversionReview
+type ConversionRequest struct {
+	UID               types.UID              `json:"uid"`
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+// ConversionResponse response of ConversionReview
+type ConversionResponse struct {
+	UID              types.UID              `json:"uid"`
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+// ConversionHandler function to convert a single custom resource to desiredAPIVersion, obj can be modified
+// in place and returned; apiVersion of the returned object is set to desiredAPIVersion if empty or unchanged
+type ConversionHandler func(ctx context.Context, obj *unstructured.Unstructured, desiredAPIVersion string) (converted *unstructured.Unstructured, err error)
+
+// WrapConversionHandlerOptions options for wrapping ConversionHandler
+type WrapConversionHandlerOptions struct {
+	Debug bool
+	// Timeout max duration of converting all objects in a ConversionReview, the 'timeout' query parameter
+	// sent by API server takes precedence if shorter, zero means no limit besides API server's
+	Timeout time.Duration
+	// Logger logger, default to slog.Default()
+	Logger *slog.Logger
+	// MaxBodySize max size of request body in bytes, default to DefaultMaxBodySize
+	MaxBodySize int64
+}
+
+// WrapConversionHandler wrap ConversionHandler to http.HandlerFunc, handler is invoked once per object not
+// already in desiredAPIVersion; if any object fails or Timeout is exceeded, the whole review fails with errors
+// of all failed objects
+func WrapConversionHandler(opts WrapConversionHandlerOptions, handler ConversionHandler) http.HandlerFunc {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	summaryLevel := slog.LevelDebug
+	if opts.Debug {
+		summaryLevel = slog.LevelInfo
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		var (
+			err       error
+			reqReview ConversionReview
+			logger    = opts.Logger.With("path", req.URL.Path)
+		)
+
+		// automatically error returning
+		defer func() {
+			if err == nil {
+				return
+			}
+			logger.Error("conversion http handler failed", "error", err.Error())
+			writeErrorResponse(rw, err)
+		}()
+
+		// validate request
+		var buf []byte
+		if buf, err = readReviewRequest(rw, req, opts.MaxBodySize); err != nil {
+			return
+		}
+
+		// decode request
+		if err = json.Unmarshal(buf, &reqReview); err != nil {
+			err = errors.New("failed to unmarshal ConversionReview request: " + err.Error())
+			return
+		}
+		if reqReview.APIVersion != "" && reqReview.APIVersion != ConversionReviewAPIVersion {
+			err = errors.New("unsupported ConversionReview version: " + reqReview.APIVersion)
+			return
+		}
+		if reqReview.Request == nil {
+			err = ErrMissingConversionRequest
+			return
+		}
+
+		logger = logger.With(
+			"uid", reqReview.Request.UID,
+			"desiredAPIVersion", reqReview.Request.DesiredAPIVersion,
+			"objects", len(reqReview.Request.Objects),
+		)
+
+		if opts.Debug {
+			raw, _ := json.MarshalIndent(reqReview, "", "  ")
+			logger.Info("conversion request received", "review", string(raw))
+		}
+
+		// execute handler
+		ctx := req.Context()
+		if timeout := handlerTimeout(req, opts.Timeout); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		res := convertObjects(ctx, logger, handler, reqReview.Request)
+
+		if res.Result.Status == metav1.StatusFailure {
+			logger.Warn("conversion failed", "error", res.Result.Message)
+		}
+
+		// send response
+		resReview := ConversionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: ConversionReviewAPIVersion, Kind: "ConversionReview"},
+			Response: res,
+		}
+
+		if err = writeJSONResponse(rw, resReview, logger, opts.Debug, "conversion response sent"); err != nil {
+			return
+		}
+
+		logger.Log(req.Context(), summaryLevel, "conversion request handled", "result", res.Result.Status)
+	}
+}
+
+// convertObjects convert all objects of req, failures of objects are collected into the result
+func convertObjects(ctx context.Context, logger *slog.Logger, handler ConversionHandler, req *ConversionRequest) (res *ConversionResponse) {
+	res = &ConversionResponse{
+		UID:    req.UID,
+		Result: metav1.Status{Status: metav1.StatusSuccess},
+	}
+
+	var failures []string
+
+	for i, raw := range req.Objects {
+		converted, err := convertObject(ctx, logger, handler, raw, req.DesiredAPIVersion)
+		if err != nil {
+			failures = append(failures, "objects["+strconv.Itoa(i)+"]: "+err.Error())
+			continue
+		}
+		res.ConvertedObjects = append(res.ConvertedObjects, converted)
+	}
+
+	if len(failures) != 0 {
+		res.ConvertedObjects = nil
+		res.Result = metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: "failed to convert to " + req.DesiredAPIVersion + ": " + strings.Join(failures, "; "),
+		}
+	}
+	return
+}
+
+// convertObject convert a single object, objects already in desiredAPIVersion are returned as is; the object
+// fails once ctx is done, without waiting for handler to return
+func convertObject(ctx context.Context, logger *slog.Logger, handler ConversionHandler, raw runtime.RawExtension, desiredAPIVersion string) (out runtime.RawExtension, err error) {
+	obj := &unstructured.Unstructured{}
+	if err = obj.UnmarshalJSON(raw.Raw); err != nil {
+		err = errors.New("failed to decode object: " + err.Error())
+		return
+	}
+
+	fromAPIVersion := obj.GetAPIVersion()
+	if fromAPIVersion == desiredAPIVersion {
+		out = raw
+		return
+	}
+
+	type result struct {
+		converted *unstructured.Unstructured
+		err       error
+	}
+
+	chResult := make(chan result, 1)
+
+	go func() {
+		var r result
+		r.converted, r.err = invokeConversionHandler(ctx, logger, handler, obj, desiredAPIVersion)
+		chResult <- r
+	}()
+
+	var converted *unstructured.Unstructured
+
+	select {
+	case r := <-chResult:
+		if converted, err = r.converted, r.err; err != nil {
+			return
+		}
+	case <-ctx.Done():
+		err = errors.New("ConversionHandler timed out: " + ctx.Err().Error())
+		return
+	}
+	if converted == nil {
+		err = errors.New("ConversionHandler returned nil object")
+		return
+	}
+
+	switch converted.GetAPIVersion() {
+	case "", fromAPIVersion:
+		converted.SetAPIVersion(desiredAPIVersion)
+	case desiredAPIVersion:
+	default:
+		err = errors.New("ConversionHandler returned object of apiVersion " + converted.GetAPIVersion())
+		return
+	}
+
+	if out.Raw, err = converted.MarshalJSON(); err != nil {
+		err = errors.New("failed to encode converted object: " + err.Error())
+		return
+	}
+	return
+}
+
+// invokeConversionHandler invoke handler, recovering panic into error
+func invokeConversionHandler(ctx context.Context, logger *slog.Logger, handler ConversionHandler, obj *unstructured.Unstructured, desiredAPIVersion string) (converted *unstructured.Unstructured, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("conversion handler panicked", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = errors.New("ConversionHandler panicked")
+		}
+	}()
+	return handler(ctx, obj, desiredAPIVersion)
+}
+
+// ConversionRoute a ConversionHandler mounted on a path
+type ConversionRoute struct {
+	// Path path to mount, see http.ServeMux
+	Path string
+	// Options options for wrapping Handler
+	Options WrapConversionHandlerOptions
+	// Handler the ConversionHandler
+	Handler ConversionHandler
+}
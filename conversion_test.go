@@ -0,0 +1,142 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func postConversionReview(t *testing.T, h http.Handler, path string, desiredAPIVersion string, objects ...string) *ConversionResponse {
+	req := &ConversionRequest{UID: "test", DesiredAPIVersion: desiredAPIVersion}
+	for _, obj := range objects {
+		req.Objects = append(req.Objects, runtime.RawExtension{Raw: []byte(obj)})
+	}
+	buf, err := json.Marshal(ConversionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: ConversionReviewAPIVersion, Kind: "ConversionReview"},
+		Request:  req,
+	})
+	require.NoError(t, err)
+
+	hreq := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(buf))
+	hreq.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, hreq)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res ConversionReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, ConversionReviewAPIVersion, res.APIVersion)
+	require.NotNil(t, res.Response)
+	require.Equal(t, req.UID, res.Response.UID)
+	return res.Response
+}
+
+func testConversionHandler(ctx context.Context, obj *unstructured.Unstructured, desiredAPIVersion string) (*unstructured.Unstructured, error) {
+	foo, _, _ := unstructured.NestedString(obj.Object, "spec", "foo")
+	switch foo {
+	case "fail":
+		return nil, errors.New("bad foo")
+	case "panic":
+		panic("bad foo")
+	}
+	unstructured.RemoveNestedField(obj.Object, "spec", "foo")
+	if err := unstructured.SetNestedField(obj.Object, foo, "spec", "bar"); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func TestWrapConversionHandler(t *testing.T) {
+	h := WrapConversionHandler(WrapConversionHandlerOptions{}, testConversionHandler)
+
+	res := postConversionReview(t, h, "/", "example.com/v2",
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"a"},"spec":{"foo":"hello"}}`,
+		`{"apiVersion":"example.com/v2","kind":"Foo","metadata":{"name":"b"},"spec":{"bar":"world"}}`,
+	)
+	require.Equal(t, metav1.StatusSuccess, res.Result.Status)
+	require.Len(t, res.ConvertedObjects, 2)
+	require.JSONEq(t, `{"apiVersion":"example.com/v2","kind":"Foo","metadata":{"name":"a"},"spec":{"bar":"hello"}}`, string(res.ConvertedObjects[0].Raw))
+	require.JSONEq(t, `{"apiVersion":"example.com/v2","kind":"Foo","metadata":{"name":"b"},"spec":{"bar":"world"}}`, string(res.ConvertedObjects[1].Raw))
+
+	res = postConversionReview(t, h, "/", "example.com/v2",
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"a"},"spec":{"foo":"hello"}}`,
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"b"},"spec":{"foo":"fail"}}`,
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"c"},"spec":{"foo":"panic"}}`,
+	)
+	require.Equal(t, metav1.StatusFailure, res.Result.Status)
+	require.Empty(t, res.ConvertedObjects)
+	require.Equal(t, "failed to convert to example.com/v2: objects[1]: bad foo; objects[2]: ConversionHandler panicked", res.Result.Message)
+
+	rec := httptest.NewRecorder()
+	hreq := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"apiVersion":"apiextensions.k8s.io/v1","kind":"ConversionReview"}`)))
+	hreq.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(rec, hreq)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestWrapConversionHandlerRequestValidation(t *testing.T) {
+	h := WrapConversionHandler(WrapConversionHandlerOptions{MaxBodySize: 64}, testConversionHandler)
+
+	serve := func(method string, contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "application/json", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+
+	rec = serve(http.MethodPost, "text/plain", "{}")
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = serve(http.MethodPost, "application/json", `{"request":{"uid":"`+strings.Repeat("a", 64)+`"}}`)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestWrapConversionHandlerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	h := WrapConversionHandler(WrapConversionHandlerOptions{Timeout: 50 * time.Millisecond}, func(ctx context.Context, obj *unstructured.Unstructured, desiredAPIVersion string) (*unstructured.Unstructured, error) {
+		// ignores ctx, the review still fails in time
+		<-block
+		return obj, nil
+	})
+
+	start := time.Now()
+	res := postConversionReview(t, h, "/", "example.com/v2",
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"a"}}`,
+	)
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, metav1.StatusFailure, res.Result.Status)
+	require.Contains(t, res.Result.Message, "ConversionHandler timed out")
+}
+
+func TestNewWebhookRouterConversion(t *testing.T) {
+	h, err := newWebhookRouter(slog.Default(), nil, []ConversionRoute{
+		{Path: "/convert/foos", Handler: testConversionHandler},
+	}, nil)
+	require.NoError(t, err)
+
+	res := postConversionReview(t, h, "/convert/foos", "example.com/v2",
+		`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"a"},"spec":{"foo":"hello"}}`,
+	)
+	require.Equal(t, metav1.StatusSuccess, res.Result.Status)
+	require.Len(t, res.ConvertedObjects, 1)
+}
@@ -0,0 +1,58 @@
+package ezadmis
+
+import (
+	"context"
+	"errors"
+)
+
+// EnforcementMode how denials of WebhookHandler are enforced
+type EnforcementMode string
+
+const (
+	// EnforcementEnforce denials are returned to API server as is
+	EnforcementEnforce EnforcementMode = "enforce"
+	// EnforcementWarn denials are turned into allowances, with the deny message attached as a warning
+	// and an audit annotation
+	EnforcementWarn EnforcementMode = "warn"
+)
+
+// ShadowDenyAuditAnnotation key of audit annotation holding the deny message of a shadowed denial
+const ShadowDenyAuditAnnotation = "shadow-deny"
+
+// resolveEnforcementMode resolve the EnforcementMode of req, from label of the namespace if configured,
+// or from opts.Enforcement
+func resolveEnforcementMode(ctx context.Context, opts WrapWebhookHandlerOptions, namespace string) (mode EnforcementMode, err error) {
+	if mode = opts.Enforcement; mode == "" {
+		mode = EnforcementEnforce
+	}
+
+	if opts.EnforcementLabel != "" && opts.NamespaceLabels != nil && namespace != "" {
+		var nsLabels map[string]string
+		if nsLabels, err = opts.NamespaceLabels(ctx, namespace); err != nil {
+			err = errors.New("failed to look up namespace labels: " + err.Error())
+			return
+		}
+		switch value := EnforcementMode(nsLabels[opts.EnforcementLabel]); value {
+		case EnforcementEnforce, EnforcementWarn:
+			mode = value
+		}
+	}
+	return
+}
+
+// shadowDeny turn the denial into an allowance, dropping patches, recording the deny message as a warning
+// and an audit annotation
+func (w *webhookResponseWriter) shadowDeny() {
+	if w.deny == nil {
+		return
+	}
+	msg := w.deny.Message
+	if msg == "" {
+		msg = string(w.deny.Reason)
+	}
+	w.deny = nil
+	w.patches = nil
+	w.object = nil
+	w.Warn("would be denied: " + msg)
+	_ = w.AuditAnnotate(ShadowDenyAuditAnnotation, msg)
+}
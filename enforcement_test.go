@@ -0,0 +1,89 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestWrapWebhookHandlerEnforcement(t *testing.T) {
+	handler := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		rw.PatchAdd("/metadata/labels", map[string]string{"a": "b"})
+		rw.Deny("no way")
+		return
+	}
+
+	nsLabels := func(ctx context.Context, namespace string) (map[string]string, error) {
+		if namespace == "broken" {
+			return nil, errors.New("boom")
+		}
+		return map[string]string{"ezadmis/enforcement": namespace}, nil
+	}
+
+	for _, item := range []struct {
+		opts      WrapWebhookHandlerOptions
+		namespace string
+		shadowed  bool
+	}{
+		{WrapWebhookHandlerOptions{}, "default", false},
+		{WrapWebhookHandlerOptions{Enforcement: EnforcementWarn}, "default", true},
+		{WrapWebhookHandlerOptions{Enforcement: EnforcementWarn, EnforcementLabel: "ezadmis/enforcement", NamespaceLabels: nsLabels}, "enforce", false},
+		{WrapWebhookHandlerOptions{Enforcement: EnforcementWarn, EnforcementLabel: "ezadmis/enforcement", NamespaceLabels: nsLabels}, "other", true},
+		{WrapWebhookHandlerOptions{Enforcement: EnforcementWarn, EnforcementLabel: "ezadmis/enforcement", NamespaceLabels: nsLabels}, "broken", true},
+		{WrapWebhookHandlerOptions{EnforcementLabel: "ezadmis/enforcement", NamespaceLabels: nsLabels}, "warn", true},
+		{WrapWebhookHandlerOptions{EnforcementLabel: "ezadmis/enforcement", NamespaceLabels: nsLabels}, "", false},
+	} {
+		res := postAdmissionReview(t, WrapWebhookHandler(item.opts, handler), "/", &admissionv1.AdmissionRequest{
+			UID:       "test",
+			Namespace: item.namespace,
+		})
+		if item.shadowed {
+			require.True(t, res.Allowed)
+			require.Nil(t, res.Result)
+			require.Nil(t, res.Patch)
+			require.Equal(t, []string{"would be denied: no way"}, res.Warnings)
+			require.Equal(t, map[string]string{ShadowDenyAuditAnnotation: "no way"}, res.AuditAnnotations)
+		} else {
+			require.False(t, res.Allowed)
+			require.Equal(t, "no way", res.Result.Message)
+			require.Empty(t, res.Warnings)
+		}
+	}
+}
+
+func TestWrapWebhookHandlerEnforcementLabel(t *testing.T) {
+	handler := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		rw.Deny("no way")
+		return
+	}
+
+	// misconfiguration is logged
+	buf := &bytes.Buffer{}
+	WrapWebhookHandler(WrapWebhookHandlerOptions{
+		EnforcementLabel: "ezadmis/enforcement",
+		Logger:           slog.New(slog.NewTextHandler(buf, nil)),
+	}, handler)
+	require.Contains(t, buf.String(), "EnforcementLabel is ignored without NamespaceLabels")
+
+	// namespace lookup is bounded by timeout of the handler
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{
+		Enforcement:      EnforcementWarn,
+		EnforcementLabel: "ezadmis/enforcement",
+		NamespaceLabels: func(ctx context.Context, namespace string) (map[string]string, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Timeout: time.Millisecond * 50,
+	}, handler)
+
+	start := time.Now()
+	res := postAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{UID: "test", Namespace: "default"})
+	require.Less(t, time.Since(start), time.Second)
+	require.True(t, res.Allowed)
+}
@@ -0,0 +1,134 @@
+package ezadmistest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yankeguo/ezadmis"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// SubjectAccessReviewBuilder builder of SubjectAccessReviewSpec
+type SubjectAccessReviewBuilder struct {
+	spec authorizationv1.SubjectAccessReviewSpec
+}
+
+// NewSubjectAccessReview create a SubjectAccessReviewBuilder for given user
+func NewSubjectAccessReview(username string, groups ...string) *SubjectAccessReviewBuilder {
+	b := &SubjectAccessReviewBuilder{}
+	b.spec.User = username
+	b.spec.Groups = groups
+	return b
+}
+
+// Resource set resource attributes, name and namespace can be empty
+func (b *SubjectAccessReviewBuilder) Resource(verb string, gvr schema.GroupVersionResource, namespace string, name string) *SubjectAccessReviewBuilder {
+	b.spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+		Verb:      verb,
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Namespace: namespace,
+		Name:      name,
+	}
+	b.spec.NonResourceAttributes = nil
+	return b
+}
+
+// Subresource set sub-resource of resource attributes
+func (b *SubjectAccessReviewBuilder) Subresource(subresource string) *SubjectAccessReviewBuilder {
+	if b.spec.ResourceAttributes == nil {
+		b.spec.ResourceAttributes = &authorizationv1.ResourceAttributes{}
+	}
+	b.spec.ResourceAttributes.Subresource = subresource
+	return b
+}
+
+// NonResource set non-resource attributes
+func (b *SubjectAccessReviewBuilder) NonResource(verb string, path string) *SubjectAccessReviewBuilder {
+	b.spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Verb: verb, Path: path}
+	b.spec.ResourceAttributes = nil
+	return b
+}
+
+// Build build the SubjectAccessReviewSpec
+func (b *SubjectAccessReviewBuilder) Build() *authorizationv1.SubjectAccessReviewSpec {
+	return b.spec.DeepCopy()
+}
+
+// AuthorizationRoundTrip send spec to handler wrapped by WrapAuthorizationHandler with opts, through a
+// httptest.Server, like API server does, returning the status received; non-200 responses are fatal
+func AuthorizationRoundTrip(t testing.TB, opts ezadmis.WrapAuthorizationHandlerOptions, handler ezadmis.AuthorizationHandler, spec *authorizationv1.SubjectAccessReviewSpec) *authorizationv1.SubjectAccessReviewStatus {
+	t.Helper()
+
+	s := httptest.NewServer(ezadmis.WrapAuthorizationHandler(opts, handler))
+	defer s.Close()
+
+	buf, err := json.Marshal(authorizationv1.SubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: authorizationv1.SchemeGroupVersion.String(),
+			Kind:       "SubjectAccessReview",
+		},
+		Spec: *spec,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode SubjectAccessReview: %s", err.Error())
+	}
+
+	hres, err := s.Client().Post(s.URL, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("failed to send SubjectAccessReview: %s", err.Error())
+	}
+	defer hres.Body.Close()
+
+	if buf, err = io.ReadAll(hres.Body); err != nil {
+		t.Fatalf("failed to read SubjectAccessReview: %s", err.Error())
+	}
+	if hres.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", hres.StatusCode, string(buf))
+	}
+
+	var review authorizationv1.SubjectAccessReview
+	if err = json.Unmarshal(buf, &review); err != nil {
+		t.Fatalf("failed to decode SubjectAccessReview: %s", err.Error())
+	}
+	return &review.Status
+}
+
+// AssertAuthorizationAllowed assert status is allowed
+func AssertAuthorizationAllowed(t testing.TB, status *authorizationv1.SubjectAccessReviewStatus) {
+	t.Helper()
+
+	if !status.Allowed || status.Denied {
+		t.Errorf("expected access to be allowed, got %s", describeAuthorization(status))
+	}
+}
+
+// AssertAuthorizationDenied assert status is denied
+func AssertAuthorizationDenied(t testing.TB, status *authorizationv1.SubjectAccessReviewStatus) {
+	t.Helper()
+
+	if status.Allowed || !status.Denied {
+		t.Errorf("expected access to be denied, got %s", describeAuthorization(status))
+	}
+}
+
+// AssertAuthorizationNoOpinion assert status is neither allowed nor denied
+func AssertAuthorizationNoOpinion(t testing.TB, status *authorizationv1.SubjectAccessReviewStatus) {
+	t.Helper()
+
+	if status.Allowed || status.Denied {
+		t.Errorf("expected no opinion, got %s", describeAuthorization(status))
+	}
+}
+
+func describeAuthorization(status *authorizationv1.SubjectAccessReviewStatus) string {
+	buf, _ := json.Marshal(status)
+	return string(buf)
+}
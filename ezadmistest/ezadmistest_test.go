@@ -0,0 +1,117 @@
+package ezadmistest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis"
+	admissionv1 "k8s.io/api/admission/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testHandler(ctx context.Context, req *admissionv1.AdmissionRequest, rw ezadmis.WebhookResponseWriter) (err error) {
+	if req.UserInfo.Username == "banned" {
+		rw.Deny("user is banned")
+		return
+	}
+	if req.DryRun != nil && *req.DryRun {
+		return
+	}
+	rw.PatchAdd("/metadata/labels", map[string]string{"patched": req.Namespace})
+	return
+}
+
+func testPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	req, err := NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Update).
+		Object(testPod()).
+		OldObject(testPod()).
+		UserInfo("alice", "dev").
+		DryRun().
+		Build()
+	require.NoError(t, err)
+	require.NotEmpty(t, req.UID)
+	require.Equal(t, "pods", req.Resource.Resource)
+	require.Equal(t, "Pod", req.RequestKind.Kind)
+	require.Equal(t, admissionv1.Update, req.Operation)
+	require.Equal(t, "test", req.Name)
+	require.Equal(t, "default", req.Namespace)
+	require.Equal(t, "alice", req.UserInfo.Username)
+	require.True(t, *req.DryRun)
+	require.Contains(t, string(req.Object.Raw), `"apiVersion":"v1"`)
+	require.Contains(t, string(req.OldObject.Raw), `"kind":"Pod"`)
+
+	_, err = NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Create).Object("invalid").Build()
+	require.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	req := NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Create).Object(testPod()).MustBuild()
+
+	res := Run(t, testHandler, req)
+	AssertAllowed(t, res)
+
+	var pod corev1.Pod
+	DecodePatchedObject(t, req, res, &pod)
+	require.Equal(t, map[string]string{"patched": "default"}, pod.Labels)
+
+	req = NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Create).Object(testPod()).UserInfo("banned").MustBuild()
+	res = Run(t, testHandler, req)
+	AssertDenied(t, res)
+	AssertDenyMessage(t, res, "user is banned")
+
+	req = NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Create).Object(testPod()).DryRun().MustBuild()
+	buf, err := PatchedObject(req, Run(t, testHandler, req))
+	require.NoError(t, err)
+	require.Equal(t, req.Object.Raw, buf)
+}
+
+func TestRoundTrip(t *testing.T) {
+	req := NewRequest(corev1.SchemeGroupVersion.WithKind("Pod"), admissionv1.Create).Object(testPod()).MustBuild()
+
+	res := RoundTrip(t, ezadmis.WrapWebhookHandlerOptions{}, testHandler, req)
+	AssertAllowed(t, res)
+
+	var pod corev1.Pod
+	DecodePatchedObject(t, req, res, &pod)
+	require.Equal(t, map[string]string{"patched": "default"}, pod.Labels)
+
+	res = RoundTrip(t, ezadmis.WrapWebhookHandlerOptions{FailureFallback: ezadmis.FallbackDeny}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw ezadmis.WebhookResponseWriter) (err error) {
+		panic(errors.New("boom"))
+	}, req)
+	AssertDenyMessage(t, res, "WebhookHandler panicked")
+}
+
+func TestAuthorizationRoundTrip(t *testing.T) {
+	handler := func(ctx context.Context, spec *authorizationv1.SubjectAccessReviewSpec) (ezadmis.AuthorizationDecision, string, error) {
+		if spec.NonResourceAttributes != nil {
+			return ezadmis.AuthorizationNoOpinion, "", nil
+		}
+		if spec.ResourceAttributes.Subresource == "exec" {
+			return ezadmis.AuthorizationDeny, "exec is not allowed", nil
+		}
+		return ezadmis.AuthorizationAllow, "", nil
+	}
+
+	status := AuthorizationRoundTrip(t, ezadmis.WrapAuthorizationHandlerOptions{}, handler,
+		NewSubjectAccessReview("alice", "dev").Resource("get", corev1.SchemeGroupVersion.WithResource("pods"), "default", "test").Build())
+	AssertAuthorizationAllowed(t, status)
+
+	status = AuthorizationRoundTrip(t, ezadmis.WrapAuthorizationHandlerOptions{}, handler,
+		NewSubjectAccessReview("alice", "dev").Resource("create", corev1.SchemeGroupVersion.WithResource("pods"), "default", "test").Subresource("exec").Build())
+	AssertAuthorizationDenied(t, status)
+	require.Equal(t, "exec is not allowed", status.Reason)
+
+	status = AuthorizationRoundTrip(t, ezadmis.WrapAuthorizationHandlerOptions{}, handler,
+		NewSubjectAccessReview("alice").NonResource("get", "/healthz").Build())
+	AssertAuthorizationNoOpinion(t, status)
+}
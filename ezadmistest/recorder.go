@@ -0,0 +1,121 @@
+package ezadmistest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/yankeguo/ezadmis"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// Recorder a WebhookResponseWriter recording what WebhookHandler writes
+type Recorder struct {
+	ezadmis.WebhookResponseWriter
+
+	req *admissionv1.AdmissionRequest
+}
+
+// NewRecorder create a Recorder for req
+func NewRecorder(req *admissionv1.AdmissionRequest) *Recorder {
+	return &Recorder{
+		WebhookResponseWriter: ezadmis.NewWebhookResponseWriter(req),
+		req:                   req,
+	}
+}
+
+// Response build the AdmissionResponse from what was recorded
+func (r *Recorder) Response() (*admissionv1.AdmissionResponse, error) {
+	return r.Build(r.req.UID)
+}
+
+// Run invoke handler with req directly, returning the AdmissionResponse built, handler errors are fatal
+func Run(t testing.TB, handler ezadmis.WebhookHandler, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	rec := NewRecorder(req)
+	if err := handler(context.Background(), req, rec); err != nil {
+		t.Fatalf("WebhookHandler failed: %s", err.Error())
+	}
+	res, err := rec.Response()
+	if err != nil {
+		t.Fatalf("failed to build AdmissionResponse: %s", err.Error())
+	}
+	return res
+}
+
+// AssertAllowed assert res is allowed
+func AssertAllowed(t testing.TB, res *admissionv1.AdmissionResponse) {
+	t.Helper()
+
+	if !res.Allowed {
+		message := ""
+		if res.Result != nil {
+			message = res.Result.Message
+		}
+		t.Errorf("expected request to be allowed, but denied: %q", message)
+	}
+}
+
+// AssertDenied assert res is denied
+func AssertDenied(t testing.TB, res *admissionv1.AdmissionResponse) {
+	t.Helper()
+
+	if res.Allowed {
+		t.Errorf("expected request to be denied, but allowed")
+	}
+}
+
+// AssertDenyMessage assert res is denied with message
+func AssertDenyMessage(t testing.TB, res *admissionv1.AdmissionResponse, message string) {
+	t.Helper()
+
+	if res.Allowed {
+		t.Errorf("expected request to be denied with %q, but allowed", message)
+		return
+	}
+	if res.Result == nil || res.Result.Message != message {
+		actual := ""
+		if res.Result != nil {
+			actual = res.Result.Message
+		}
+		t.Errorf("expected request to be denied with %q, but denied with %q", message, actual)
+	}
+}
+
+// PatchedObject apply patches of res to the incoming object of req, returning the patched object
+func PatchedObject(req *admissionv1.AdmissionRequest, res *admissionv1.AdmissionResponse) (buf []byte, err error) {
+	buf = req.Object.Raw
+	if len(res.Patch) == 0 {
+		return
+	}
+	if len(buf) == 0 {
+		err = errors.New("PatchedObject: missing object in request")
+		return
+	}
+	var patch jsonpatch.Patch
+	if patch, err = jsonpatch.DecodePatch(res.Patch); err != nil {
+		err = errors.New("PatchedObject: failed to decode patch: " + err.Error())
+		return
+	}
+	if buf, err = patch.Apply(buf); err != nil {
+		err = errors.New("PatchedObject: failed to apply patch: " + err.Error())
+		return
+	}
+	return
+}
+
+// DecodePatchedObject apply patches of res to the incoming object of req, and decode the patched object into out
+func DecodePatchedObject(t testing.TB, req *admissionv1.AdmissionRequest, res *admissionv1.AdmissionResponse, out any) {
+	t.Helper()
+
+	buf, err := PatchedObject(req, res)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err = json.Unmarshal(buf, out); err != nil {
+		t.Fatalf("failed to decode patched object: %s", err.Error())
+	}
+}
@@ -0,0 +1,142 @@
+// Package ezadmistest utilities for testing WebhookHandler, without a running API server
+package ezadmistest
+
+import (
+	"encoding/json"
+	"errors"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// RequestBuilder builder of AdmissionRequest
+type RequestBuilder struct {
+	req admissionv1.AdmissionRequest
+	err error
+}
+
+// NewRequest create a RequestBuilder for given kind and operation, resource is guessed from kind,
+// UID is randomly generated
+func NewRequest(gvk schema.GroupVersionKind, operation admissionv1.Operation) *RequestBuilder {
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	b := &RequestBuilder{}
+	b.req.UID = uuid.NewUUID()
+	b.req.Kind = metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+	b.req.Resource = metav1.GroupVersionResource{Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource}
+	b.req.Operation = operation
+	return b
+}
+
+// UID set UID of the request
+func (b *RequestBuilder) UID(uid string) *RequestBuilder {
+	b.req.UID = types.UID(uid)
+	return b
+}
+
+// SubResource set sub-resource of the request
+func (b *RequestBuilder) SubResource(subResource string) *RequestBuilder {
+	b.req.SubResource = subResource
+	return b
+}
+
+// Namespace set namespace of the request, default to namespace of the object
+func (b *RequestBuilder) Namespace(namespace string) *RequestBuilder {
+	b.req.Namespace = namespace
+	return b
+}
+
+// Name set name of the request, default to name of the object
+func (b *RequestBuilder) Name(name string) *RequestBuilder {
+	b.req.Name = name
+	return b
+}
+
+// Object set the incoming object, apiVersion and kind are filled from the kind of the request if missing
+func (b *RequestBuilder) Object(obj any) *RequestBuilder {
+	b.req.Object = b.encode(obj)
+	return b
+}
+
+// OldObject set the existing object, apiVersion and kind are filled from the kind of the request if missing
+func (b *RequestBuilder) OldObject(obj any) *RequestBuilder {
+	b.req.OldObject = b.encode(obj)
+	return b
+}
+
+// UserInfo set user of the request
+func (b *RequestBuilder) UserInfo(username string, groups ...string) *RequestBuilder {
+	b.req.UserInfo = authenticationv1.UserInfo{Username: username, Groups: groups}
+	return b
+}
+
+// DryRun mark the request as dry-run
+func (b *RequestBuilder) DryRun() *RequestBuilder {
+	dryRun := true
+	b.req.DryRun = &dryRun
+	return b
+}
+
+// encode encode obj as JSON, filling apiVersion and kind
+func (b *RequestBuilder) encode(obj any) (ext runtime.RawExtension) {
+	if b.err != nil {
+		return
+	}
+
+	var (
+		buf []byte
+		m   map[string]any
+	)
+	if buf, b.err = json.Marshal(obj); b.err != nil {
+		b.err = errors.New("RequestBuilder: failed to encode object: " + b.err.Error())
+		return
+	}
+	if b.err = json.Unmarshal(buf, &m); b.err != nil {
+		b.err = errors.New("RequestBuilder: object must be encoded as a JSON object: " + b.err.Error())
+		return
+	}
+
+	if apiVersion, _ := m["apiVersion"].(string); apiVersion == "" {
+		m["apiVersion"] = schema.GroupVersion{Group: b.req.Kind.Group, Version: b.req.Kind.Version}.String()
+	}
+	if kind, _ := m["kind"].(string); kind == "" {
+		m["kind"] = b.req.Kind.Kind
+	}
+
+	if metadata, ok := m["metadata"].(map[string]any); ok {
+		if name, _ := metadata["name"].(string); b.req.Name == "" {
+			b.req.Name = name
+		}
+		if namespace, _ := metadata["namespace"].(string); b.req.Namespace == "" {
+			b.req.Namespace = namespace
+		}
+	}
+
+	ext.Raw, b.err = json.Marshal(m)
+	return
+}
+
+// Build build the AdmissionRequest
+func (b *RequestBuilder) Build() (*admissionv1.AdmissionRequest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	req := b.req.DeepCopy()
+	req.RequestKind = req.Kind.DeepCopy()
+	req.RequestResource = req.Resource.DeepCopy()
+	return req, nil
+}
+
+// MustBuild build the AdmissionRequest, panics on error
+func (b *RequestBuilder) MustBuild() *admissionv1.AdmissionRequest {
+	req, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return req
+}
@@ -0,0 +1,59 @@
+package ezadmistest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yankeguo/ezadmis"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RoundTrip send req to handler wrapped by WrapWebhookHandler with opts, through a httptest.Server, like
+// API server does, returning the AdmissionResponse received; non-200 responses are fatal
+func RoundTrip(t testing.TB, opts ezadmis.WrapWebhookHandlerOptions, handler ezadmis.WebhookHandler, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	t.Helper()
+
+	s := httptest.NewServer(ezadmis.WrapWebhookHandler(opts, handler))
+	defer s.Close()
+
+	buf, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request: req,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode AdmissionReview: %s", err.Error())
+	}
+
+	hres, err := s.Client().Post(s.URL, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("failed to send AdmissionReview: %s", err.Error())
+	}
+	defer hres.Body.Close()
+
+	if buf, err = io.ReadAll(hres.Body); err != nil {
+		t.Fatalf("failed to read AdmissionReview: %s", err.Error())
+	}
+	if hres.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code %d: %s", hres.StatusCode, string(buf))
+	}
+
+	var review admissionv1.AdmissionReview
+	if err = json.Unmarshal(buf, &review); err != nil {
+		t.Fatalf("failed to decode AdmissionReview: %s", err.Error())
+	}
+	if review.Response == nil {
+		t.Fatalf("missing response in AdmissionReview")
+	}
+	if review.Response.UID != req.UID {
+		t.Fatalf("unexpected UID %q in response, expected %q", review.Response.UID, req.UID)
+	}
+	return review.Response
+}
@@ -0,0 +1,107 @@
+package ezadmis
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadinessCheck function to check whether WebhookServer is ready to serve
+type ReadinessCheck func(ctx context.Context) error
+
+type readinessChecks struct {
+	mu     sync.Mutex
+	checks map[string]ReadinessCheck
+}
+
+func (c *readinessChecks) add(name string, check ReadinessCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks == nil {
+		c.checks = map[string]ReadinessCheck{}
+	}
+	c.checks[name] = check
+}
+
+// run run all checks in order of names, and returns report lines and whether all checks passed
+func (c *readinessChecks) run(ctx context.Context) (lines []string, ok bool) {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	checks := make([]ReadinessCheck, 0, len(names))
+	slices.Sort(names)
+	for _, name := range names {
+		checks = append(checks, c.checks[name])
+	}
+	c.mu.Unlock()
+
+	ok = true
+
+	for i, name := range names {
+		if err := checks[i](ctx); err != nil {
+			ok = false
+			lines = append(lines, "[-]"+name+" failed: "+err.Error())
+		} else {
+			lines = append(lines, "[+]"+name+" ok")
+		}
+	}
+	return
+}
+
+// checkCertificate ensure cert is loaded and valid at the moment
+func checkCertificate(cert *tls.Certificate) (err error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return errors.New("certificate not loaded")
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return
+		}
+	}
+
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return errors.New("certificate not valid before " + leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(leaf.NotAfter) {
+		return errors.New("certificate expired at " + leaf.NotAfter.Format(time.RFC3339))
+	}
+	return
+}
+
+func serveHealthz(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = rw.Write([]byte("ok"))
+}
+
+func serveReadyz(checks *readinessChecks) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		lines, ok := checks.run(req.Context())
+		if ok {
+			lines = append(lines, "readyz check passed")
+		} else {
+			lines = append(lines, "readyz check failed")
+		}
+		buf := []byte(strings.Join(lines, "\n") + "\n")
+
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+		if ok {
+			rw.WriteHeader(http.StatusOK)
+		} else {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = rw.Write(buf)
+	}
+}
@@ -0,0 +1,47 @@
+package ezadmis
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+)
+
+func TestWebhookServerHealth(t *testing.T) {
+	s := NewWebhookServer(WebhookServerOptions{}).(*webhookServer)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.s.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, get("/healthz").Code)
+
+	rec := get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "[-]certificate failed: certificate not loaded")
+
+	pair, err := x509util.Generate(x509util.GenerateOptions{IsCA: true, Names: []string{"test"}})
+	require.NoError(t, err)
+	cert, err := tls.X509KeyPair(pair.Crt, pair.Key)
+	require.NoError(t, err)
+	s.certs.cert.Store(&cert)
+
+	rec = get("/readyz")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "[+]certificate ok")
+
+	s.AddReadinessCheck("informer", func(ctx context.Context) error {
+		return errors.New("cache not synced")
+	})
+
+	rec = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.Contains(t, rec.Body.String(), "[-]informer failed: cache not synced")
+}
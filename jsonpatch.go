@@ -0,0 +1,165 @@
+package ezadmis
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// decodeJSONDocument decode a JSON document with numbers kept as json.Number
+func decodeJSONDocument(buf []byte) (out any, err error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	err = dec.Decode(&out)
+	return
+}
+
+// createJSONPatch compute JSONPatch operations transforming JSON document src into dst
+func createJSONPatch(src, dst []byte) (patches []map[string]any, err error) {
+	var a, b any
+	if a, err = decodeJSONDocument(src); err != nil {
+		return
+	}
+	if b, err = decodeJSONDocument(dst); err != nil {
+		return
+	}
+	patches = diffJSONValue(nil, "", a, b)
+	return
+}
+
+func diffJSONValue(patches []map[string]any, path string, a, b any) []map[string]any {
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			return diffJSONObject(patches, path, av, bv)
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			return diffJSONArray(patches, path, av, bv)
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return patches
+	}
+
+	return append(patches, map[string]any{
+		"op":    "replace",
+		"path":  path,
+		"value": b,
+	})
+}
+
+func diffJSONObject(patches []map[string]any, path string, a, b map[string]any) []map[string]any {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		av, inA := a[k]
+		bv, inB := b[k]
+
+		p := path + "/" + jsonPointerEscaper.Replace(k)
+
+		switch {
+		case inA && inB:
+			patches = diffJSONValue(patches, p, av, bv)
+		case inA:
+			patches = append(patches, map[string]any{
+				"op":   "remove",
+				"path": p,
+			})
+		default:
+			patches = append(patches, map[string]any{
+				"op":    "add",
+				"path":  p,
+				"value": bv,
+			})
+		}
+	}
+
+	return patches
+}
+
+func diffJSONArray(patches []map[string]any, path string, a, b []any) []map[string]any {
+	n := min(len(a), len(b))
+
+	for i := 0; i < n; i++ {
+		patches = diffJSONValue(patches, path+"/"+strconv.Itoa(i), a[i], b[i])
+	}
+
+	// remove from the tail, keeping indexes of preceding elements stable
+	for i := len(a) - 1; i >= n; i-- {
+		patches = append(patches, map[string]any{
+			"op":   "remove",
+			"path": path + "/" + strconv.Itoa(i),
+		})
+	}
+
+	for i := n; i < len(b); i++ {
+		patches = append(patches, map[string]any{
+			"op":    "add",
+			"path":  path + "/" + strconv.Itoa(i),
+			"value": b[i],
+		})
+	}
+
+	return patches
+}
+
+// verifyJSONPatch apply patch to the object of req, and ensure the patched object still decodes as the requested kind
+func verifyJSONPatch(req *admissionv1.AdmissionRequest, patch []byte) (err error) {
+	var p jsonpatch.Patch
+	if p, err = jsonpatch.DecodePatch(patch); err != nil {
+		err = errors.New("invalid patch: " + err.Error())
+		return
+	}
+
+	var buf []byte
+	if buf, err = p.Apply(req.Object.Raw); err != nil {
+		err = errors.New("failed to apply patch: " + err.Error())
+		return
+	}
+
+	gvk := schema.GroupVersionKind{
+		Group:   req.Kind.Group,
+		Version: req.Kind.Version,
+		Kind:    req.Kind.Kind,
+	}
+
+	if err = checkObjectKind(buf, gvk); err != nil {
+		err = errors.New("patched object: " + err.Error())
+		return
+	}
+
+	var obj any
+	if obj, err = scheme.Scheme.New(gvk); err != nil {
+		// unknown kinds are only checked to be a JSON object
+		obj, err = &map[string]any{}, nil
+	}
+
+	if err = json.Unmarshal(buf, obj); err != nil {
+		err = errors.New("failed to decode patched object: " + err.Error())
+		return
+	}
+
+	return
+}
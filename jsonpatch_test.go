@@ -0,0 +1,70 @@
+package ezadmis
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCreateJSONPatch(t *testing.T) {
+	for _, item := range []struct {
+		src string
+		dst string
+		out string
+	}{
+		{
+			src: `{"a":1,"b":{"c":"d"}}`,
+			dst: `{"a":1,"b":{"c":"d"}}`,
+			out: `null`,
+		},
+		{
+			src: `{"a":1,"b":{"c":"d"}}`,
+			dst: `{"a":2,"b":{"e":"f"}}`,
+			out: `[{"op":"replace","path":"/a","value":2},{"op":"remove","path":"/b/c"},{"op":"add","path":"/b/e","value":"f"}]`,
+		},
+		{
+			src: `{"metadata":{"labels":{"app.kubernetes.io/name":"a"}}}`,
+			dst: `{"metadata":{"labels":{"app.kubernetes.io/name":"b","x~y":"z"}}}`,
+			out: `[{"op":"replace","path":"/metadata/labels/app.kubernetes.io~1name","value":"b"},{"op":"add","path":"/metadata/labels/x~0y","value":"z"}]`,
+		},
+		{
+			src: `{"items":[1,2,3,4]}`,
+			dst: `{"items":[1,5]}`,
+			out: `[{"op":"replace","path":"/items/1","value":5},{"op":"remove","path":"/items/3"},{"op":"remove","path":"/items/2"}]`,
+		},
+		{
+			src: `{"items":[{"name":"a"}]}`,
+			dst: `{"items":[{"name":"a","image":"b"},{"name":"c"}]}`,
+			out: `[{"op":"add","path":"/items/0/image","value":"b"},{"op":"add","path":"/items/1","value":{"name":"c"}}]`,
+		},
+		{
+			src: `{"a":{"b":1}}`,
+			dst: `{"a":[1]}`,
+			out: `[{"op":"replace","path":"/a","value":[1]}]`,
+		},
+	} {
+		patches, err := createJSONPatch([]byte(item.src), []byte(item.dst))
+		require.NoError(t, err)
+		buf, err := json.Marshal(patches)
+		require.NoError(t, err)
+		require.JSONEq(t, item.out, string(buf))
+	}
+}
+
+func TestVerifyJSONPatch(t *testing.T) {
+	req := &admissionv1.AdmissionRequest{
+		Kind: metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Object: runtime.RawExtension{
+			Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"test"},"spec":{"containers":[{"name":"a"}]}}`),
+		},
+	}
+
+	require.NoError(t, verifyJSONPatch(req, []byte(`[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`)))
+	require.ErrorContains(t, verifyJSONPatch(req, []byte(`[{"op":"remove","path":"/metadata/labels/a"}]`)), "failed to apply patch")
+	require.ErrorContains(t, verifyJSONPatch(req, []byte(`[{"op":"replace","path":"/kind","value":"Service"}]`)), "kind mismatch")
+	require.ErrorContains(t, verifyJSONPatch(req, []byte(`[{"op":"replace","path":"/spec/containers","value":"a"}]`)), "failed to decode patched object")
+}
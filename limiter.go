@@ -0,0 +1,71 @@
+package ezadmis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errLimiterQueueFull    = errors.New("too many requests in flight and queue is full")
+	errLimiterQueueTimeout = errors.New("timed out waiting in queue")
+)
+
+// inflightLimiter limit requests in flight, with an optional queue for requests exceeding the limit
+type inflightLimiter struct {
+	slots     chan struct{}
+	queued    atomic.Int64
+	maxQueued int64
+	timeout   time.Duration
+}
+
+// newInflightLimiter create a inflightLimiter, returns nil if maxInFlight is not positive
+func newInflightLimiter(maxInFlight int, maxQueued int, timeout time.Duration) *inflightLimiter {
+	if maxInFlight <= 0 {
+		return nil
+	}
+	return &inflightLimiter{
+		slots:     make(chan struct{}, maxInFlight),
+		maxQueued: int64(maxQueued),
+		timeout:   timeout,
+	}
+}
+
+func (l *inflightLimiter) release() {
+	<-l.slots
+}
+
+// acquire acquire a slot, waiting in queue if necessary, release must be called once done
+func (l *inflightLimiter) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case l.slots <- struct{}{}:
+		release = l.release
+		return
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		err = errLimiterQueueFull
+		return
+	}
+	defer l.queued.Add(-1)
+
+	var chTimeout <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		chTimeout = timer.C
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		release = l.release
+	case <-chTimeout:
+		err = errLimiterQueueTimeout
+	case <-ctx.Done():
+		err = errors.New("canceled waiting in queue: " + ctx.Err().Error())
+	}
+	return
+}
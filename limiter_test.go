@@ -0,0 +1,101 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+func TestInflightLimiter(t *testing.T) {
+	require.Nil(t, newInflightLimiter(0, 10, time.Second))
+
+	l := newInflightLimiter(1, 1, time.Millisecond*50)
+
+	release, err := l.acquire(context.Background())
+	require.NoError(t, err)
+
+	// queued request times out
+	_, err = l.acquire(context.Background())
+	require.ErrorIs(t, err, errLimiterQueueTimeout)
+
+	// queued request acquires once released
+	chErr := make(chan error, 1)
+	go func() {
+		r, err := l.acquire(context.Background())
+		if err == nil {
+			defer r()
+		}
+		chErr <- err
+	}()
+	require.Eventually(t, func() bool { return l.queued.Load() == 1 }, time.Second, time.Millisecond)
+
+	// queue is full
+	_, err = l.acquire(context.Background())
+	require.ErrorIs(t, err, errLimiterQueueFull)
+
+	release()
+	require.NoError(t, <-chErr)
+}
+
+func TestWrapWebhookHandlerShedding(t *testing.T) {
+	for _, policy := range []FallbackPolicy{FallbackError, FallbackAllow} {
+		metrics := NewWebhookMetrics()
+
+		chStarted := make(chan struct{})
+		chBlock := make(chan struct{})
+
+		h := WrapWebhookHandler(WrapWebhookHandlerOptions{
+			MaxInFlight:      1,
+			SheddingFallback: policy,
+			Metrics:          metrics,
+		}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+			close(chStarted)
+			<-chBlock
+			rw.Deny("denied")
+			return
+		})
+
+		// request is built, and assertions are made, on the test goroutine
+		buf, err := json.Marshal(admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UID: "1"}})
+		require.NoError(t, err)
+		hreq := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf))
+		hreq.Header.Set("Content-Type", "application/json")
+
+		chRec := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, hreq)
+			chRec <- rec
+		}()
+
+		// wait until the first request holds the slot
+		<-chStarted
+
+		if policy == FallbackError {
+			// failurePolicy of the webhook configuration decides by default
+			rec := serveAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{UID: "2"})
+			require.Equal(t, http.StatusInternalServerError, rec.Code)
+			require.Contains(t, rec.Body.String(), "load shedding")
+		} else {
+			res := postAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{UID: "2"})
+			require.True(t, res.Allowed)
+		}
+
+		close(chBlock)
+
+		rec := <-chRec
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.Contains(t, rec.Body.String(), `"allowed":false`)
+
+		rec = httptest.NewRecorder()
+		metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Contains(t, rec.Body.String(), `ezadmis_webhook_shed_total{path="/",resource="",operation="",namespace=""} 1`)
+	}
+}
@@ -0,0 +1,161 @@
+package ezadmis
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	metricLabelNames = []string{"path", "resource", "operation", "namespace"}
+
+	metricDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	metricLabelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// renderMetricLabels render label pairs in Prometheus text format, without braces
+func renderMetricLabels(names []string, values []string) string {
+	pairs := make([]string, 0, len(names))
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+metricLabelValueEscaper.Replace(values[i])+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type metricHistogramSeries struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// WebhookMetrics metrics of WrapWebhookHandler, served in Prometheus text format
+type WebhookMetrics struct {
+	mu        sync.Mutex
+	requests  map[string]float64
+	decisions map[string]float64
+	patches   map[string]float64
+	durations map[string]*metricHistogramSeries
+	shed      map[string]float64
+}
+
+// NewWebhookMetrics create a WebhookMetrics
+func NewWebhookMetrics() *WebhookMetrics {
+	return &WebhookMetrics{
+		requests:  map[string]float64{},
+		decisions: map[string]float64{},
+		patches:   map[string]float64{},
+		durations: map[string]*metricHistogramSeries{},
+		shed:      map[string]float64{},
+	}
+}
+
+// observe record a request handled by WrapWebhookHandler, req and res may be nil if failed early,
+// shed indicates the request was rejected by concurrency limit
+func (m *WebhookMetrics) observe(path string, req *admissionv1.AdmissionRequest, res *admissionv1.AdmissionResponse, err error, shed bool, duration time.Duration) {
+	values := []string{path, "", "", ""}
+	if req != nil {
+		values[1] = schema.GroupResource{Group: req.Resource.Group, Resource: req.Resource.Resource}.String()
+		values[2] = string(req.Operation)
+		values[3] = req.Namespace
+	}
+	labels := renderMetricLabels(metricLabelNames, values)
+
+	decision := admissionDecision(res, err)
+
+	var patches int
+	if err == nil && res != nil && len(res.Patch) != 0 {
+		var ops []json.RawMessage
+		if json.Unmarshal(res.Patch, &ops) == nil {
+			patches = len(ops)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[labels]++
+	m.decisions[labels+`,decision="`+decision+`"`]++
+	m.patches[labels] += float64(patches)
+	if shed {
+		m.shed[labels]++
+	}
+
+	series := m.durations[labels]
+	if series == nil {
+		series = &metricHistogramSeries{buckets: make([]uint64, len(metricDurationBuckets))}
+		m.durations[labels] = series
+	}
+	seconds := duration.Seconds()
+	for i, le := range metricDurationBuckets {
+		if seconds <= le {
+			series.buckets[i]++
+		}
+	}
+	series.sum += seconds
+	series.count++
+}
+
+func writeMetricHeader(buf *bytes.Buffer, name, typ, help string) {
+	buf.WriteString("# HELP " + name + " " + help + "\n")
+	buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeMetricCounter(buf *bytes.Buffer, name, help string, values map[string]float64) {
+	writeMetricHeader(buf, name, "counter", help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		buf.WriteString(name + "{" + k + "} " + formatMetricValue(values[k]) + "\n")
+	}
+}
+
+func writeMetricHistogram(buf *bytes.Buffer, name, help string, values map[string]*metricHistogramSeries) {
+	writeMetricHeader(buf, name, "histogram", help)
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		series := values[k]
+		for i, le := range metricDurationBuckets {
+			buf.WriteString(name + "_bucket{" + k + `,le="` + formatMetricValue(le) + `"} ` + strconv.FormatUint(series.buckets[i], 10) + "\n")
+		}
+		buf.WriteString(name + "_bucket{" + k + `,le="+Inf"} ` + strconv.FormatUint(series.count, 10) + "\n")
+		buf.WriteString(name + "_sum{" + k + "} " + formatMetricValue(series.sum) + "\n")
+		buf.WriteString(name + "_count{" + k + "} " + strconv.FormatUint(series.count, 10) + "\n")
+	}
+}
+
+// ServeHTTP serve metrics in Prometheus text format
+func (m *WebhookMetrics) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	buf := &bytes.Buffer{}
+
+	m.mu.Lock()
+	writeMetricCounter(buf, "ezadmis_webhook_requests_total", "Total number of admission requests.", m.requests)
+	writeMetricCounter(buf, "ezadmis_webhook_decisions_total", "Total number of admission decisions, by allowed, denied or error.", m.decisions)
+	writeMetricCounter(buf, "ezadmis_webhook_patch_operations_total", "Total number of JSONPatch operations returned.", m.patches)
+	writeMetricCounter(buf, "ezadmis_webhook_shed_total", "Total number of admission requests shed by concurrency limit.", m.shed)
+	writeMetricHistogram(buf, "ezadmis_webhook_request_duration_seconds", "Duration of admission requests in seconds.", m.durations)
+	m.mu.Unlock()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	_, _ = rw.Write(buf.Bytes())
+}
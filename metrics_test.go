@@ -0,0 +1,54 @@
+package ezadmis
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWebhookMetrics(t *testing.T) {
+	metrics := NewWebhookMetrics()
+
+	h := http.NewServeMux()
+	h.Handle("/mutate/", WrapWebhookHandler(WrapWebhookHandlerOptions{Metrics: metrics}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		if req.Namespace == "kube-system" {
+			rw.Deny("denied")
+			return
+		}
+		rw.PatchAdd("/metadata/labels/a", "b")
+		rw.PatchAdd("/metadata/labels/c", "d")
+		return
+	}))
+
+	resource := metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+	// requested paths under the same pattern share the path label
+	postAdmissionReview(t, h, "/mutate/a", &admissionv1.AdmissionRequest{UID: "1", Resource: resource, Operation: admissionv1.Create, Namespace: "default"})
+	postAdmissionReview(t, h, "/mutate/b", &admissionv1.AdmissionRequest{UID: "2", Resource: resource, Operation: admissionv1.Create, Namespace: "default"})
+	postAdmissionReview(t, h, "/mutate/c", &admissionv1.AdmissionRequest{UID: "3", Resource: resource, Operation: admissionv1.Create, Namespace: "kube-system"})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate/d", nil))
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	out := rec.Body.String()
+
+	const labels = `path="/mutate/",resource="deployments.apps",operation="CREATE",namespace="default"`
+
+	require.Contains(t, out, "# TYPE ezadmis_webhook_requests_total counter\n")
+	require.Contains(t, out, `ezadmis_webhook_requests_total{`+labels+`} 2`+"\n")
+	require.Contains(t, out, `ezadmis_webhook_decisions_total{`+labels+`,decision="allowed"} 2`+"\n")
+	require.Contains(t, out, `ezadmis_webhook_decisions_total{path="/mutate/",resource="deployments.apps",operation="CREATE",namespace="kube-system",decision="denied"} 1`+"\n")
+	require.Contains(t, out, `ezadmis_webhook_decisions_total{path="/mutate/",resource="",operation="",namespace="",decision="error"} 1`+"\n")
+	require.Contains(t, out, `ezadmis_webhook_patch_operations_total{`+labels+`} 4`+"\n")
+	require.Contains(t, out, "# TYPE ezadmis_webhook_request_duration_seconds histogram\n")
+	require.Contains(t, out, `ezadmis_webhook_request_duration_seconds_bucket{`+labels+`,le="+Inf"} 2`+"\n")
+	require.Contains(t, out, `ezadmis_webhook_request_duration_seconds_count{`+labels+`} 2`+"\n")
+}
@@ -0,0 +1,133 @@
+package ezadmis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WebhookMiddleware function to wrap WebhookHandler with cross-cutting logic
+type WebhookMiddleware func(handler WebhookHandler) WebhookHandler
+
+// ChainWebhookMiddlewares wrap handler with middlewares, the first middleware is the outermost
+func ChainWebhookMiddlewares(handler WebhookHandler, middlewares ...WebhookMiddleware) WebhookHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// NamespaceLabelsFunc function to look up labels of a namespace
+type NamespaceLabelsFunc func(ctx context.Context, namespace string) (map[string]string, error)
+
+// NamespaceLabelsFromClient create a NamespaceLabelsFunc getting namespace from API server on every call
+func NamespaceLabelsFromClient(client kubernetes.Interface) NamespaceLabelsFunc {
+	return func(ctx context.Context, namespace string) (map[string]string, error) {
+		ns, err := client.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return ns.Labels, nil
+	}
+}
+
+// skipWebhookMiddleware create a WebhookMiddleware allowing requests without invoking handler, if skip returns true
+func skipWebhookMiddleware(skip func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error)) WebhookMiddleware {
+	return func(handler WebhookHandler) WebhookHandler {
+		return func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+			var skipped bool
+			if skipped, err = skip(ctx, req); err != nil || skipped {
+				return
+			}
+			return handler(ctx, req, rw)
+		}
+	}
+}
+
+// SkipNamespaces skip requests in given namespaces
+func SkipNamespaces(namespaces ...string) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error) {
+		return req.Namespace != "" && slices.Contains(namespaces, req.Namespace), nil
+	})
+}
+
+// SkipNamespaceSelector skip requests in namespaces with labels matching selector, requests of cluster-scoped
+// resources are never skipped
+func SkipNamespaceSelector(selector labels.Selector, lookup NamespaceLabelsFunc) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (skipped bool, err error) {
+		if req.Namespace == "" {
+			return
+		}
+		var nsLabels map[string]string
+		if nsLabels, err = lookup(ctx, req.Namespace); err != nil {
+			err = errors.New("SkipNamespaceSelector: failed to look up namespace labels: " + err.Error())
+			return
+		}
+		skipped = selector.Matches(labels.Set(nsLabels))
+		return
+	})
+}
+
+// SkipObjectSelector skip requests with object labels matching selector, labels of old object are used
+// if object is missing (DELETE)
+func SkipObjectSelector(selector labels.Selector) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (skipped bool, err error) {
+		raw := req.Object.Raw
+		if len(raw) == 0 {
+			raw = req.OldObject.Raw
+		}
+		if len(raw) == 0 {
+			return
+		}
+		var obj struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		}
+		if err = json.Unmarshal(raw, &obj); err != nil {
+			err = errors.New("SkipObjectSelector: failed to decode object: " + err.Error())
+			return
+		}
+		skipped = selector.Matches(labels.Set(obj.Metadata.Labels))
+		return
+	})
+}
+
+// SkipDryRun skip dry-run requests
+func SkipDryRun() WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error) {
+		return req.DryRun != nil && *req.DryRun, nil
+	})
+}
+
+// SkipUsers skip requests from given usernames
+func SkipUsers(usernames ...string) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error) {
+		return slices.Contains(usernames, req.UserInfo.Username), nil
+	})
+}
+
+// SkipGroups skip requests from users in any of given groups
+func SkipGroups(groups ...string) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error) {
+		for _, group := range req.UserInfo.Groups {
+			if slices.Contains(groups, group) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// OnlyOperations skip requests with operations other than given ones
+func OnlyOperations(operations ...admissionv1.Operation) WebhookMiddleware {
+	return skipWebhookMiddleware(func(ctx context.Context, req *admissionv1.AdmissionRequest) (bool, error) {
+		return !slices.Contains(operations, req.Operation), nil
+	})
+}
@@ -0,0 +1,82 @@
+package ezadmis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestChainWebhookMiddlewares(t *testing.T) {
+	var calls []string
+
+	trace := func(name string) WebhookMiddleware {
+		return func(handler WebhookHandler) WebhookHandler {
+			return func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+				calls = append(calls, name)
+				return handler(ctx, req, rw)
+			}
+		}
+	}
+
+	handler := ChainWebhookMiddlewares(
+		func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+			calls = append(calls, "handler")
+			return
+		},
+		trace("a"),
+		trace("b"),
+	)
+
+	require.NoError(t, handler(context.Background(), &admissionv1.AdmissionRequest{}, &webhookResponseWriter{}))
+	require.Equal(t, []string{"a", "b", "handler"}, calls)
+}
+
+func TestSkipMiddlewares(t *testing.T) {
+	dryRun := true
+
+	nsLabels := func(ctx context.Context, namespace string) (map[string]string, error) {
+		return map[string]string{"exempt": namespace}, nil
+	}
+
+	for _, item := range []struct {
+		middleware WebhookMiddleware
+		req        *admissionv1.AdmissionRequest
+		skipped    bool
+	}{
+		{SkipNamespaces("kube-system"), &admissionv1.AdmissionRequest{Namespace: "kube-system"}, true},
+		{SkipNamespaces("kube-system"), &admissionv1.AdmissionRequest{Namespace: "default"}, false},
+		{SkipNamespaceSelector(labels.SelectorFromSet(labels.Set{"exempt": "a"}), nsLabels), &admissionv1.AdmissionRequest{Namespace: "a"}, true},
+		{SkipNamespaceSelector(labels.SelectorFromSet(labels.Set{"exempt": "a"}), nsLabels), &admissionv1.AdmissionRequest{Namespace: "b"}, false},
+		{SkipNamespaceSelector(labels.SelectorFromSet(labels.Set{"exempt": ""}), nsLabels), &admissionv1.AdmissionRequest{}, false},
+		{
+			SkipObjectSelector(labels.SelectorFromSet(labels.Set{"skip": "true"})),
+			&admissionv1.AdmissionRequest{Object: runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"skip":"true"}}}`)}},
+			true,
+		},
+		{
+			SkipObjectSelector(labels.SelectorFromSet(labels.Set{"skip": "true"})),
+			&admissionv1.AdmissionRequest{OldObject: runtime.RawExtension{Raw: []byte(`{"metadata":{"labels":{"skip":"false"}}}`)}},
+			false,
+		},
+		{SkipDryRun(), &admissionv1.AdmissionRequest{DryRun: &dryRun}, true},
+		{SkipDryRun(), &admissionv1.AdmissionRequest{}, false},
+		{SkipUsers("system:admin"), &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Username: "system:admin"}}, true},
+		{SkipGroups("system:masters"), &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Groups: []string{"system:authenticated", "system:masters"}}}, true},
+		{SkipGroups("system:masters"), &admissionv1.AdmissionRequest{UserInfo: authenticationv1.UserInfo{Groups: []string{"system:authenticated"}}}, false},
+		{OnlyOperations(admissionv1.Create), &admissionv1.AdmissionRequest{Operation: admissionv1.Update}, true},
+		{OnlyOperations(admissionv1.Create, admissionv1.Update), &admissionv1.AdmissionRequest{Operation: admissionv1.Update}, false},
+	} {
+		var called bool
+		handler := item.middleware(func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+			called = true
+			return
+		})
+		require.NoError(t, handler(context.Background(), item.req, &webhookResponseWriter{}))
+		require.Equal(t, item.skipped, !called)
+	}
+}
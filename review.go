@@ -0,0 +1,97 @@
+package ezadmis
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// decodeAdmissionReview decode a AdmissionReview of version v1 or v1beta1, v1beta1 request is converted to v1,
+// and TypeMeta is kept for responding in the same version
+func decodeAdmissionReview(r io.Reader) (review admissionv1.AdmissionReview, err error) {
+	var buf []byte
+	if buf, err = io.ReadAll(r); err != nil {
+		return
+	}
+
+	var meta metav1.TypeMeta
+	if err = json.Unmarshal(buf, &meta); err != nil {
+		return
+	}
+
+	switch meta.APIVersion {
+	case admissionv1beta1.SchemeGroupVersion.String():
+		var in admissionv1beta1.AdmissionReview
+		if err = json.Unmarshal(buf, &in); err != nil {
+			return
+		}
+		review.TypeMeta = in.TypeMeta
+		review.Request = convertAdmissionRequestFromV1beta1(in.Request)
+	case admissionv1.SchemeGroupVersion.String(), "":
+		if err = json.Unmarshal(buf, &review); err != nil {
+			return
+		}
+		review.APIVersion = admissionv1.SchemeGroupVersion.String()
+		review.Kind = "AdmissionReview"
+	default:
+		err = errors.New("unsupported AdmissionReview version: " + meta.APIVersion)
+	}
+	return
+}
+
+// encodeAdmissionReview convert review to v1beta1 if its TypeMeta says so
+func encodeAdmissionReview(review admissionv1.AdmissionReview) any {
+	if review.APIVersion != admissionv1beta1.SchemeGroupVersion.String() {
+		return review
+	}
+	return admissionv1beta1.AdmissionReview{
+		TypeMeta: review.TypeMeta,
+		Response: convertAdmissionResponseToV1beta1(review.Response),
+	}
+}
+
+func convertAdmissionRequestFromV1beta1(in *admissionv1beta1.AdmissionRequest) *admissionv1.AdmissionRequest {
+	if in == nil {
+		return nil
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:                in.UID,
+		Kind:               in.Kind,
+		Resource:           in.Resource,
+		SubResource:        in.SubResource,
+		RequestKind:        in.RequestKind,
+		RequestResource:    in.RequestResource,
+		RequestSubResource: in.RequestSubResource,
+		Name:               in.Name,
+		Namespace:          in.Namespace,
+		Operation:          admissionv1.Operation(in.Operation),
+		UserInfo:           in.UserInfo,
+		Object:             in.Object,
+		OldObject:          in.OldObject,
+		DryRun:             in.DryRun,
+		Options:            in.Options,
+	}
+}
+
+func convertAdmissionResponseToV1beta1(in *admissionv1.AdmissionResponse) *admissionv1beta1.AdmissionResponse {
+	if in == nil {
+		return nil
+	}
+	out := &admissionv1beta1.AdmissionResponse{
+		UID:              in.UID,
+		Allowed:          in.Allowed,
+		Result:           in.Result,
+		Patch:            in.Patch,
+		AuditAnnotations: in.AuditAnnotations,
+		Warnings:         in.Warnings,
+	}
+	if in.PatchType != nil {
+		patchType := admissionv1beta1.PatchType(*in.PatchType)
+		out.PatchType = &patchType
+	}
+	return out
+}
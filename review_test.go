@@ -0,0 +1,63 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWrapWebhookHandlerV1beta1(t *testing.T) {
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		require.Equal(t, admissionv1.Create, req.Operation)
+		require.Equal(t, "test", req.Name)
+		rw.PatchAdd("/metadata/labels", map[string]any{"a": "b"})
+		return
+	})
+
+	buf, err := json.Marshal(admissionv1beta1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1beta1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       "1",
+			Name:      "test",
+			Operation: admissionv1beta1.Create,
+		},
+	})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(buf))
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res admissionv1beta1.AdmissionReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.Equal(t, admissionv1beta1.SchemeGroupVersion.String(), res.APIVersion)
+	require.Equal(t, "AdmissionReview", res.Kind)
+	require.Equal(t, "1", string(res.Response.UID))
+	require.True(t, res.Response.Allowed)
+	require.Equal(t, admissionv1beta1.PatchTypeJSONPatch, *res.Response.PatchType)
+}
+
+func TestDecodeAdmissionReview(t *testing.T) {
+	review, err := decodeAdmissionReview(strings.NewReader(`{"request":{"uid":"1"}}`))
+	require.NoError(t, err)
+	require.Equal(t, admissionv1.SchemeGroupVersion.String(), review.APIVersion)
+	require.Equal(t, "1", string(review.Request.UID))
+
+	_, err = decodeAdmissionReview(strings.NewReader(`{"apiVersion":"admission.k8s.io/v2","kind":"AdmissionReview"}`))
+	require.ErrorContains(t, err, "unsupported AdmissionReview version")
+}
@@ -0,0 +1,78 @@
+package ezadmis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// WebhookServerTLSOptions TLS options for WebhookServer
+type WebhookServerTLSOptions struct {
+	// MinVersion minimum TLS version, such as tls.VersionTLS13, default to Go's default
+	MinVersion uint16
+	// CipherSuites cipher suites for TLS 1.2 and below, default to Go's default, TLS 1.3 cipher suites are not configurable
+	CipherSuites []uint16
+	// ClientCAFile if not empty, client certificates are verified against CA bundle in this file,
+	// and webhook requests without a verified client certificate are rejected; '/healthz' and '/readyz' are exempted
+	ClientCAFile string
+	// ClientNames if not empty, webhook requests are only accepted if the common name or any DNS name of the
+	// client certificate is listed, requires ClientCAFile
+	ClientNames []string
+}
+
+// createTLSConfig create tls.Config from opts, with certificates from getCertificate
+func createTLSConfig(opts WebhookServerTLSOptions, getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (cfg *tls.Config, err error) {
+	if len(opts.ClientNames) != 0 && opts.ClientCAFile == "" {
+		err = errors.New("ClientNames requires ClientCAFile, client certificates are not verified without it")
+		return
+	}
+
+	cfg = &tls.Config{
+		GetCertificate: getCertificate,
+		MinVersion:     opts.MinVersion,
+		CipherSuites:   opts.CipherSuites,
+	}
+
+	if opts.ClientCAFile != "" {
+		var buf []byte
+		if buf, err = os.ReadFile(opts.ClientCAFile); err != nil {
+			return
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			err = errors.New("no certificate found in client CA file: " + opts.ClientCAFile)
+			return
+		}
+		cfg.ClientCAs = pool
+		// client certificate is enforced by requireClientCertificate, keeping health checks available to kubelet
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return
+}
+
+// requireClientCertificate wrap handler, rejecting requests without a verified client certificate,
+// or with a client certificate not listed in names if names is not empty
+func requireClientCertificate(names []string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			http.Error(rw, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		if len(names) != 0 {
+			crt := req.TLS.VerifiedChains[0][0]
+			if !slices.Contains(names, crt.Subject.CommonName) && !slices.ContainsFunc(crt.DNSNames, func(name string) bool {
+				return slices.Contains(names, name)
+			}) {
+				http.Error(rw, "client certificate not allowed: "+crt.Subject.CommonName, http.StatusForbidden)
+				return
+			}
+		}
+
+		handler.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,68 @@
+package ezadmis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yankeguo/ezadmis/pkg/x509util"
+)
+
+func TestCreateTLSConfig(t *testing.T) {
+	cfg, err := createTLSConfig(WebhookServerTLSOptions{MinVersion: tls.VersionTLS13}, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), cfg.MinVersion)
+	require.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	ca, err := x509util.Generate(x509util.GenerateOptions{IsCA: true, Names: []string{"test-ca"}})
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(file, ca.Crt, 0644))
+
+	cfg, err = createTLSConfig(WebhookServerTLSOptions{ClientCAFile: file}, nil)
+	require.NoError(t, err)
+	require.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+	require.NotNil(t, cfg.ClientCAs)
+
+	_, err = createTLSConfig(WebhookServerTLSOptions{ClientNames: []string{"kube-apiserver"}}, nil)
+	require.ErrorContains(t, err, "ClientNames requires ClientCAFile")
+
+	require.NoError(t, os.WriteFile(file, []byte("invalid"), 0644))
+	_, err = createTLSConfig(WebhookServerTLSOptions{ClientCAFile: file}, nil)
+	require.Error(t, err)
+}
+
+func TestRequireClientCertificate(t *testing.T) {
+	h := requireClientCertificate([]string{"kube-apiserver"}, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(crt *x509.Certificate) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if crt != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{crt}}}
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve(nil))
+	require.Equal(t, http.StatusOK, serve(&x509.Certificate{Subject: pkix.Name{CommonName: "kube-apiserver"}}))
+	require.Equal(t, http.StatusOK, serve(&x509.Certificate{DNSNames: []string{"kube-apiserver"}}))
+	require.Equal(t, http.StatusForbidden, serve(&x509.Certificate{Subject: pkix.Name{CommonName: "someone-else"}}))
+}
+
+func TestNewWebhookServerClientNamesWithoutCA(t *testing.T) {
+	s := NewWebhookServer(WebhookServerOptions{
+		TLS: WebhookServerTLSOptions{ClientNames: []string{"kube-apiserver"}},
+	})
+	require.ErrorContains(t, s.ListenAndServe(), "ClientNames requires ClientCAFile")
+}
@@ -0,0 +1,107 @@
+package ezadmis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// TypedWebhookHandler function to review incoming kubernetes resource decoded as T;
+// obj is nil if req.Object is empty (DELETE), oldObj is nil if req.OldObject is empty (CREATE, CONNECT)
+type TypedWebhookHandler[T any] func(ctx context.Context, req *admissionv1.AdmissionRequest, obj *T, oldObj *T, rw WebhookResponseWriter) (err error)
+
+// TypedWebhookHandlerOptions options for wrapping TypedWebhookHandler
+type TypedWebhookHandlerOptions struct {
+	// Kinds accepted kinds, if empty, kinds of T will be looked up from Scheme;
+	// any kind is accepted if T is unstructured or unknown to Scheme
+	Kinds []schema.GroupVersionKind
+	// Scheme scheme for looking up kinds of T, default to client-go scheme,
+	// register CRD types to a custom scheme to enable kind checking
+	Scheme *runtime.Scheme
+}
+
+// WrapTypedWebhookHandler wrap TypedWebhookHandler to WebhookHandler, requests with mismatched kind
+// or undecodable objects are denied without invoking handler
+func WrapTypedWebhookHandler[T any](opts TypedWebhookHandlerOptions, handler TypedWebhookHandler[T]) WebhookHandler {
+	if opts.Scheme == nil {
+		opts.Scheme = scheme.Scheme
+	}
+
+	kinds := opts.Kinds
+
+	if len(kinds) == 0 {
+		if _, ok := any(new(T)).(runtime.Unstructured); !ok {
+			if obj, ok := any(new(T)).(runtime.Object); ok {
+				kinds, _, _ = opts.Scheme.ObjectKinds(obj)
+			}
+		}
+	}
+
+	return func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		gvk := schema.GroupVersionKind{
+			Group:   req.Kind.Group,
+			Version: req.Kind.Version,
+			Kind:    req.Kind.Kind,
+		}
+
+		if len(kinds) != 0 && !slices.Contains(kinds, gvk) {
+			rw.Deny("unexpected kind: " + gvk.String())
+			return
+		}
+
+		var obj, oldObj *T
+
+		if obj, err = decodeTypedObject[T](req.Object.Raw, gvk); err != nil {
+			rw.Deny("failed to decode object: " + err.Error())
+			err = nil
+			return
+		}
+
+		if oldObj, err = decodeTypedObject[T](req.OldObject.Raw, gvk); err != nil {
+			rw.Deny("failed to decode old object: " + err.Error())
+			err = nil
+			return
+		}
+
+		return handler(ctx, req, obj, oldObj, rw)
+	}
+}
+
+// decodeTypedObject decode raw as T, and ensure apiVersion and kind of raw, if present, matches gvk
+func decodeTypedObject[T any](raw []byte, gvk schema.GroupVersionKind) (out *T, err error) {
+	if len(raw) == 0 {
+		return
+	}
+
+	if err = checkObjectKind(raw, gvk); err != nil {
+		return
+	}
+
+	out = new(T)
+	if err = json.Unmarshal(raw, out); err != nil {
+		out = nil
+		return
+	}
+	return
+}
+
+// checkObjectKind ensure apiVersion and kind of raw, if present, matches gvk
+func checkObjectKind(raw []byte, gvk schema.GroupVersionKind) (err error) {
+	var meta runtime.TypeMeta
+	if err = json.Unmarshal(raw, &meta); err != nil {
+		return
+	}
+	if meta.APIVersion != "" || meta.Kind != "" {
+		if actual := schema.FromAPIVersionAndKind(meta.APIVersion, meta.Kind); actual != gvk {
+			err = errors.New("kind mismatch, expected " + gvk.String() + ", got " + actual.String())
+			return
+		}
+	}
+	return
+}
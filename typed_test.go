@@ -0,0 +1,110 @@
+package ezadmis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newTestAdmissionRequest(t *testing.T, kind metav1.GroupVersionKind, obj any, oldObj any) *admissionv1.AdmissionRequest {
+	req := &admissionv1.AdmissionRequest{
+		UID:  types.UID("test"),
+		Kind: kind,
+	}
+	if obj != nil {
+		buf, err := json.Marshal(obj)
+		require.NoError(t, err)
+		req.Object = runtime.RawExtension{Raw: buf}
+	}
+	if oldObj != nil {
+		buf, err := json.Marshal(oldObj)
+		require.NoError(t, err)
+		req.OldObject = runtime.RawExtension{Raw: buf}
+	}
+	return req
+}
+
+func TestWrapTypedWebhookHandler(t *testing.T) {
+	var called bool
+
+	handler := WrapTypedWebhookHandler(
+		TypedWebhookHandlerOptions{},
+		func(ctx context.Context, req *admissionv1.AdmissionRequest, obj *corev1.Pod, oldObj *corev1.Pod, rw WebhookResponseWriter) (err error) {
+			called = true
+			require.NotNil(t, obj)
+			require.Nil(t, oldObj)
+			require.Equal(t, "test-pod", obj.Name)
+			return
+		},
+	)
+
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pod"},
+	}
+
+	req := newTestAdmissionRequest(t, metav1.GroupVersionKind{Version: "v1", Kind: "Pod"}, pod, nil)
+	rw := &webhookResponseWriter{}
+	require.NoError(t, handler(context.Background(), req, rw))
+	require.True(t, called)
+	require.Nil(t, rw.deny)
+
+	called = false
+
+	deployment := &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test-deployment"},
+	}
+
+	req = newTestAdmissionRequest(t, metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, deployment, nil)
+	rw = &webhookResponseWriter{}
+	require.NoError(t, handler(context.Background(), req, rw))
+	require.False(t, called)
+	require.Contains(t, rw.deny.Message, "unexpected kind")
+}
+
+func TestWrapTypedWebhookHandlerUnstructured(t *testing.T) {
+	var called bool
+
+	handler := WrapTypedWebhookHandler(
+		TypedWebhookHandlerOptions{},
+		func(ctx context.Context, req *admissionv1.AdmissionRequest, obj *unstructured.Unstructured, oldObj *unstructured.Unstructured, rw WebhookResponseWriter) (err error) {
+			called = true
+			require.Equal(t, "Widget", obj.GetKind())
+			require.Equal(t, "new", obj.GetName())
+			require.Equal(t, "old", oldObj.GetName())
+			return
+		},
+	)
+
+	kind := metav1.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+
+	req := newTestAdmissionRequest(t, kind,
+		map[string]any{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": map[string]any{"name": "new"}},
+		map[string]any{"apiVersion": "example.com/v1", "kind": "Widget", "metadata": map[string]any{"name": "old"}},
+	)
+	rw := &webhookResponseWriter{}
+	require.NoError(t, handler(context.Background(), req, rw))
+	require.True(t, called)
+	require.Nil(t, rw.deny)
+
+	called = false
+
+	req = newTestAdmissionRequest(t, kind,
+		map[string]any{"apiVersion": "example.com/v1", "kind": "Gadget", "metadata": map[string]any{"name": "new"}},
+		nil,
+	)
+	rw = &webhookResponseWriter{}
+	require.NoError(t, handler(context.Background(), req, rw))
+	require.False(t, called)
+	require.Contains(t, rw.deny.Message, "kind mismatch")
+}
@@ -1,19 +1,29 @@
 package ezadmis
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
@@ -24,6 +34,16 @@ import (
 type WebhookResponseWriter interface {
 	// Deny deny this admission request
 	Deny(deny string)
+	// DenyStatus deny this admission request with a structured status, Code, Reason and Details.Causes
+	// are shown to client like built-in validation errors; missing Code is derived from Reason,
+	// errors from k8s.io/apimachinery/pkg/api/errors can be used via their ErrStatus field
+	DenyStatus(status metav1.Status)
+	// Warn append a warning returned to the client whether the request is allowed or denied,
+	// a warning is truncated to MaxWarningLength characters, and dropped if total length exceeds MaxWarningsLength
+	Warn(msg string)
+	// AuditAnnotate set an audit annotation whether the request is allowed or denied, key must be a valid
+	// name part of a qualified name, since the API server will prefix it with name of the webhook
+	AuditAnnotate(key string, value string) error
 	// PatchRaw append a raw JSONPatch operation
 	PatchRaw(patch map[string]any)
 	// PatchAdd append a JSONPatch 'add' operation
@@ -38,18 +58,122 @@ type WebhookResponseWriter interface {
 	PatchMove(path string, from string)
 	// PatchTest append a JSONPatch 'test' operation
 	PatchTest(path string, value any)
+	// PatchObject set the mutated copy of the incoming object, JSONPatch operations against the
+	// original object decoded into the same type will be computed in Build and placed before any
+	// hand-written operations
+	PatchObject(obj any)
 
 	// Build build a admission response
 	Build(uid types.UID) (res *admissionv1.AdmissionResponse, err error)
 }
 
+const (
+	// MaxWarningLength max length of a single warning, API server truncates longer warnings
+	MaxWarningLength = 256
+	// MaxWarningsLength max total length of warnings, API server ignores additional warnings
+	MaxWarningsLength = 4096
+)
+
+// NewWebhookResponseWriter create a WebhookResponseWriter for req, for invoking WebhookHandler directly, e.g. in tests
+func NewWebhookResponseWriter(req *admissionv1.AdmissionRequest) WebhookResponseWriter {
+	return &webhookResponseWriter{original: req.Object.Raw}
+}
+
 type webhookResponseWriter struct {
-	patches []map[string]any
-	deny    string
+	original         []byte
+	object           any
+	patches          []map[string]any
+	deny             *metav1.Status
+	warnings         []string
+	warningsLength   int
+	auditAnnotations map[string]string
 }
 
 func (w *webhookResponseWriter) Deny(deny string) {
-	w.deny = deny
+	if deny == "" {
+		w.deny = nil
+		return
+	}
+	w.deny = &metav1.Status{
+		Message: deny,
+		Reason:  metav1.StatusReasonBadRequest,
+	}
+}
+
+var statusReasonCodes = map[metav1.StatusReason]int32{
+	metav1.StatusReasonBadRequest:            http.StatusBadRequest,
+	metav1.StatusReasonUnauthorized:          http.StatusUnauthorized,
+	metav1.StatusReasonForbidden:             http.StatusForbidden,
+	metav1.StatusReasonNotFound:              http.StatusNotFound,
+	metav1.StatusReasonMethodNotAllowed:      http.StatusMethodNotAllowed,
+	metav1.StatusReasonNotAcceptable:         http.StatusNotAcceptable,
+	metav1.StatusReasonAlreadyExists:         http.StatusConflict,
+	metav1.StatusReasonConflict:              http.StatusConflict,
+	metav1.StatusReasonGone:                  http.StatusGone,
+	metav1.StatusReasonExpired:               http.StatusGone,
+	metav1.StatusReasonRequestEntityTooLarge: http.StatusRequestEntityTooLarge,
+	metav1.StatusReasonUnsupportedMediaType:  http.StatusUnsupportedMediaType,
+	metav1.StatusReasonInvalid:               http.StatusUnprocessableEntity,
+	metav1.StatusReasonTooManyRequests:       http.StatusTooManyRequests,
+	metav1.StatusReasonInternalError:         http.StatusInternalServerError,
+	metav1.StatusReasonServerTimeout:         http.StatusInternalServerError,
+	metav1.StatusReasonServiceUnavailable:    http.StatusServiceUnavailable,
+	metav1.StatusReasonTimeout:               http.StatusGatewayTimeout,
+}
+
+func (w *webhookResponseWriter) DenyStatus(status metav1.Status) {
+	status.Status = metav1.StatusFailure
+	if status.Reason == "" {
+		status.Reason = metav1.StatusReasonBadRequest
+	}
+	if status.Code == 0 {
+		status.Code = statusReasonCodes[status.Reason]
+	}
+	w.deny = &status
+}
+
+func (w *webhookResponseWriter) Warn(msg string) {
+	// API server drops warnings with non-printable characters
+	msg = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\t' || unicode.IsPrint(r) {
+			return r
+		}
+		return ' '
+	}, msg))
+
+	if msg == "" {
+		return
+	}
+
+	if runes := []rune(msg); len(runes) > MaxWarningLength {
+		msg = string(runes[:MaxWarningLength-3]) + "..."
+	}
+
+	if slices.Contains(w.warnings, msg) {
+		return
+	}
+
+	length := utf8.RuneCountInString(msg)
+	if w.warningsLength+length > MaxWarningsLength {
+		return
+	}
+
+	w.warnings = append(w.warnings, msg)
+	w.warningsLength += length
+}
+
+func (w *webhookResponseWriter) AuditAnnotate(key string, value string) error {
+	if strings.Contains(key, "/") {
+		return errors.New("WebhookResponseWriter#AuditAnnotate(): invalid key " + strconv.Quote(key) + ": must not contain '/'")
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+		return errors.New("WebhookResponseWriter#AuditAnnotate(): invalid key " + strconv.Quote(key) + ": " + strings.Join(errs, "; "))
+	}
+	if w.auditAnnotations == nil {
+		w.auditAnnotations = map[string]string{}
+	}
+	w.auditAnnotations[key] = value
+	return nil
 }
 
 func (w *webhookResponseWriter) PatchRaw(patch map[string]any) {
@@ -103,29 +227,79 @@ func (w *webhookResponseWriter) PatchTest(path string, value any) {
 	})
 }
 
+func (w *webhookResponseWriter) PatchObject(obj any) {
+	w.object = obj
+}
+
 func (w *webhookResponseWriter) Build(uid types.UID) (res *admissionv1.AdmissionResponse, err error) {
 	res = &admissionv1.AdmissionResponse{
-		UID:     uid,
-		Allowed: w.deny == "",
+		UID:              uid,
+		Allowed:          w.deny == nil,
+		Warnings:         w.warnings,
+		AuditAnnotations: w.auditAnnotations,
 	}
 
-	if w.deny == "" {
-		if len(w.patches) != 0 {
+	if w.deny == nil {
+		patches := w.patches
+
+		if w.object != nil {
+			if patches, err = w.computePatches(); err != nil {
+				err = errors.New("WebhookResponseWriter#Build(): " + err.Error())
+				return
+			}
+		}
+
+		if len(patches) != 0 {
 			res.PatchType = new(admissionv1.PatchType)
 			*res.PatchType = admissionv1.PatchTypeJSONPatch
-			if res.Patch, err = json.Marshal(w.patches); err != nil {
+			if res.Patch, err = json.Marshal(patches); err != nil {
 				err = errors.New("WebhookResponseWriter#Build(): " + err.Error())
 				return
 			}
 		}
 	} else {
-		res.Result = &metav1.Status{
-			Status:  metav1.StatusFailure,
-			Message: w.deny,
-			Reason:  metav1.StatusReasonBadRequest,
-		}
+		res.Result = w.deny.DeepCopy()
+		res.Result.Status = metav1.StatusFailure
+	}
+
+	return
+}
+
+// computePatches compute JSONPatch operations from the mutated object, followed by hand-written operations
+func (w *webhookResponseWriter) computePatches() (patches []map[string]any, err error) {
+	if len(w.original) == 0 {
+		err = errors.New("PatchObject: missing original object")
+		return
+	}
+
+	// decode original into the same type, so fields unknown to the type, and fields always serialized
+	// by the type, are identical on both sides and never become operations
+	typ := reflect.TypeOf(w.object)
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	original := reflect.New(typ).Interface()
+	if err = json.Unmarshal(w.original, original); err != nil {
+		err = errors.New("PatchObject: failed to decode original object: " + err.Error())
+		return
+	}
+
+	var src, dst []byte
+	if src, err = json.Marshal(original); err != nil {
+		err = errors.New("PatchObject: " + err.Error())
+		return
+	}
+	if dst, err = json.Marshal(w.object); err != nil {
+		err = errors.New("PatchObject: " + err.Error())
+		return
+	}
+
+	if patches, err = createJSONPatch(src, dst); err != nil {
+		err = errors.New("PatchObject: " + err.Error())
+		return
 	}
 
+	patches = append(patches, w.patches...)
 	return
 }
 
@@ -135,94 +309,548 @@ type WebhookHandler func(ctx context.Context, req *admissionv1.AdmissionRequest,
 // WrapWebhookHandlerOptions options for wrapping WebhookHandler
 type WrapWebhookHandlerOptions struct {
 	Debug bool
+	// VerifyPatch apply patches to the incoming object before responding, ensuring the patches apply
+	// cleanly and the patched object still decodes as the requested kind
+	VerifyPatch bool
+	// VerifyPatchFallback decision to make when VerifyPatch fails, default to FallbackError
+	VerifyPatchFallback FallbackPolicy
+	// Timeout max duration of WebhookHandler, the 'timeout' query parameter sent by API server
+	// takes precedence if shorter, zero means no limit besides API server's
+	Timeout time.Duration
+	// FailureFallback decision to make when WebhookHandler panics or times out, default to FallbackError; note the
+	// default deliberately answers with a plain HTTP 500 instead of a well-formed AdmissionReview, so failurePolicy
+	// of the webhook configuration decides, as it did before panics were recovered, set FallbackDeny or
+	// FallbackAllow to respond with an AdmissionReview
+	FailureFallback FallbackPolicy
+	// Metrics if not nil, metrics of requests will be recorded
+	Metrics *WebhookMetrics
+	// Logger logger, default to slog.Default()
+	Logger *slog.Logger
+	// MaxBodySize max size of request body in bytes, default to DefaultMaxBodySize
+	MaxBodySize int64
+	// MaxInFlight max number of requests handled concurrently, zero means unlimited
+	MaxInFlight int
+	// MaxQueued max number of requests waiting for MaxInFlight, zero means no waiting
+	MaxQueued int
+	// QueueTimeout max duration of waiting for MaxInFlight, zero means waiting until timeout of the request
+	QueueTimeout time.Duration
+	// SheddingFallback decision to make for requests exceeding MaxInFlight and MaxQueued, or QueueTimeout,
+	// default to FallbackError, a plain HTTP 500 like FailureFallback
+	SheddingFallback FallbackPolicy
+	// Enforcement how denials of WebhookHandler are enforced, default to EnforcementEnforce
+	Enforcement EnforcementMode
+	// EnforcementLabel if not empty, the value of this label of the namespace, 'enforce' or 'warn',
+	// overrides Enforcement, NamespaceLabels is required, otherwise it's ignored with an error logged
+	EnforcementLabel string
+	// NamespaceLabels function to look up labels of a namespace for EnforcementLabel
+	NamespaceLabels NamespaceLabelsFunc
+}
+
+// DefaultMaxBodySize default max size of request body, large enough for an AdmissionReview carrying
+// both object and old object at max size allowed by API server
+const DefaultMaxBodySize = 10 << 20
+
+var (
+	// ErrMethodNotAllowed request method is not POST, responded with HTTP 405
+	ErrMethodNotAllowed = errors.New("method not allowed, only POST is accepted")
+	// ErrUnsupportedMediaType request content type is not JSON, responded with HTTP 415
+	ErrUnsupportedMediaType = errors.New("unsupported media type, only application/json is accepted")
+	// ErrBodyTooLarge request body exceeds MaxBodySize, responded with HTTP 413
+	ErrBodyTooLarge = errors.New("request body too large")
+	// ErrMissingRequest AdmissionReview has no request, responded with HTTP 400
+	ErrMissingRequest = errors.New("missing request in AdmissionReview")
+)
+
+// httpStatusOf HTTP status code for errors of WrapWebhookHandler
+func httpStatusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrMethodNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMissingRequest), errors.Is(err, ErrMissingConversionRequest),
+		errors.Is(err, ErrMissingSubjectAccessReviewSpec):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// readReviewRequest validate method and content type of a review request sent by API server, and read its body,
+// limited to maxBodySize
+func readReviewRequest(rw http.ResponseWriter, req *http.Request, maxBodySize int64) (buf []byte, err error) {
+	if req.Method != http.MethodPost {
+		err = fmt.Errorf("%w: %s", ErrMethodNotAllowed, req.Method)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType != "application/json" {
+		err = fmt.Errorf("%w: %s", ErrUnsupportedMediaType, req.Header.Get("Content-Type"))
+		return
+	}
+	if buf, err = io.ReadAll(http.MaxBytesReader(rw, req.Body, maxBodySize)); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			err = fmt.Errorf("%w: limit is %d bytes", ErrBodyTooLarge, mbe.Limit)
+		} else {
+			err = errors.New("failed to read request body: " + err.Error())
+		}
+		return
+	}
+	return
+}
+
+// writeErrorResponse write err as a plain text response, with status code of httpStatusOf
+func writeErrorResponse(rw http.ResponseWriter, err error) {
+	if errors.Is(err, ErrMethodNotAllowed) {
+		rw.Header().Set("Allow", http.MethodPost)
+	}
+	http.Error(rw, err.Error(), httpStatusOf(err))
+}
+
+// writeJSONResponse marshal and write v as a JSON response, indented and logged with message in debug mode
+func writeJSONResponse(rw http.ResponseWriter, v any, logger *slog.Logger, debug bool, message string) (err error) {
+	var buf []byte
+	if debug {
+		buf, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		buf, err = json.Marshal(v)
+	}
+	if err != nil {
+		err = errors.New("failed to marshal response: " + err.Error())
+		return
+	}
+
+	if debug {
+		logger.Info(message, "review", string(buf))
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	_, _ = rw.Write(buf)
+	return
+}
+
+// FallbackPolicy decision to make when a request can not be handled normally
+type FallbackPolicy int
+
+const (
+	// FallbackError answer with HTTP 500, leaving the decision to failurePolicy of the webhook configuration, the default
+	FallbackError FallbackPolicy = iota
+	// FallbackDeny deny the request, regardless of failurePolicy
+	FallbackDeny
+	// FallbackAllow allow the request, with all patches discarded
+	FallbackAllow
+)
+
+// applyFallback override res with decision of policy, warnings and audit annotations are kept,
+// FallbackError must be handled by caller
+func applyFallback(res *admissionv1.AdmissionResponse, policy FallbackPolicy, message string) {
+	res.Patch = nil
+	res.PatchType = nil
+
+	if policy == FallbackAllow {
+		res.Allowed = true
+		res.Result = nil
+		return
+	}
+
+	res.Allowed = false
+	res.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: message,
+		Reason:  metav1.StatusReasonInternalError,
+		Code:    http.StatusInternalServerError,
+	}
 }
 
 // WrapWebhookHandler wrap WebhookHandler to http.HandlerFunc
 func WrapWebhookHandler(opts WrapWebhookHandlerOptions, handler WebhookHandler) http.HandlerFunc {
-	var debugLock sync.Locker
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.MaxBodySize == 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	if opts.EnforcementLabel != "" && opts.NamespaceLabels == nil {
+		opts.Logger.Error("EnforcementLabel is ignored without NamespaceLabels", "label", opts.EnforcementLabel)
+	}
+
+	limiter := newInflightLimiter(opts.MaxInFlight, opts.MaxQueued, opts.QueueTimeout)
 
+	// summary of each request is only visible in debug mode, unless logger is configured with debug level
+	summaryLevel := slog.LevelDebug
 	if opts.Debug {
-		debugLock = &sync.Mutex{}
+		summaryLevel = slog.LevelInfo
 	}
 
 	return func(rw http.ResponseWriter, req *http.Request) {
-		if opts.Debug {
-			// debug lock
-			debugLock.Lock()
-			defer debugLock.Unlock()
-
-			// debug log separator
-			sep := strings.Repeat("=", 80)
-			log.Println(sep)
-			defer log.Println(sep)
+		var (
+			err       error
+			shed      bool
+			reqReview admissionv1.AdmissionReview
+			resReview admissionv1.AdmissionReview
+			logger    = opts.Logger.With("path", req.URL.Path)
+		)
+
+		// record metrics
+		if opts.Metrics != nil {
+			start := time.Now()
+			defer func() {
+				opts.Metrics.observe(metricPathOf(req), reqReview.Request, resReview.Response, err, shed, time.Since(start))
+			}()
 		}
 
 		// automatically error returning
-		var err error
 		defer func() {
 			if err == nil {
 				return
 			}
-			log.Println("ezadmis: webhook http handler failed:", err.Error())
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			logger.Error("webhook http handler failed", "decision", admissionDecision(nil, err), "error", err.Error())
+			writeErrorResponse(rw, err)
 		}()
 
+		// validate request
+		var buf []byte
+		if buf, err = readReviewRequest(rw, req, opts.MaxBodySize); err != nil {
+			return
+		}
+
 		// decode request
-		var reqReview admissionv1.AdmissionReview
-		if err = json.NewDecoder(req.Body).Decode(&reqReview); err != nil {
+		if reqReview, err = decodeAdmissionReview(bytes.NewReader(buf)); err != nil {
 			err = errors.New("failed to unmarshal AdmissionReview request: " + err.Error())
 			return
 		}
 
+		if reqReview.Request == nil {
+			err = ErrMissingRequest
+			return
+		}
+
+		logger = logger.With(requestLogAttrs(reqReview.Request)...)
+
 		if opts.Debug {
-			log.Println("Request:")
 			raw, _ := json.MarshalIndent(reqReview, "", "  ")
-			log.Println(string(raw))
+			logger.Info("admission request received", "review", string(raw))
 		}
 
 		// build response
-		resReview := admissionv1.AdmissionReview{
-			TypeMeta: reqReview.TypeMeta,
-		}
+		resReview.TypeMeta = reqReview.TypeMeta
 
 		// execute handler
 		{
-			wrw := &webhookResponseWriter{}
+			ctx := req.Context()
+
+			if timeout := handlerTimeout(req, opts.Timeout); timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+
+			wrw := &webhookResponseWriter{original: reqReview.Request.Object.Raw}
+
+			var failure string
+
+			// the slot is held until handler returns, even if the request timed out
+			release := func() {}
+			if limiter != nil {
+				var shedErr error
+				if release, shedErr = limiter.acquire(ctx); shedErr != nil {
+					shed = true
+					failure = "load shedding: " + shedErr.Error()
+				}
+			}
+
+			if !shed {
+				chErr := make(chan error, 1)
+
+				go func() {
+					defer release()
+					chErr <- invokeWebhookHandler(ctx, logger, handler, reqReview.Request, wrw)
+				}()
+
+				select {
+				case err = <-chErr:
+					var pe *webhookPanicError
+					if errors.As(err, &pe) {
+						failure = "WebhookHandler panicked"
+						err = nil
+					} else if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+						failure = "WebhookHandler timed out"
+						err = nil
+					}
+				case <-ctx.Done():
+					failure = "WebhookHandler timed out"
+				}
+			}
 
-			if err = handler(req.Context(), reqReview.Request, wrw); err != nil {
+			if err != nil {
 				err = errors.New("failed to execute WebhookHandler: " + err.Error())
 				return
 			}
 
-			if resReview.Response, err = wrw.Build(reqReview.Request.UID); err != nil {
-				err = errors.New("failed to build AdmissionReview response: " + err.Error())
+			if failure != "" && (shed && opts.SheddingFallback == FallbackError || !shed && opts.FailureFallback == FallbackError) {
+				err = errors.New(failure)
 				return
 			}
+
+			if shed {
+				resReview.Response = &admissionv1.AdmissionResponse{UID: reqReview.Request.UID}
+				applyFallback(resReview.Response, opts.SheddingFallback, failure)
+				logger.Warn("request shed", "decision", admissionDecision(resReview.Response, nil), "error", failure)
+			} else if failure != "" {
+				resReview.Response = &admissionv1.AdmissionResponse{UID: reqReview.Request.UID}
+				applyFallback(resReview.Response, opts.FailureFallback, failure)
+				logger.Error("webhook handler failed", "decision", admissionDecision(resReview.Response, nil), "error", failure)
+			} else {
+				if wrw.deny != nil {
+					mode, modeErr := resolveEnforcementMode(ctx, opts, reqReview.Request.Namespace)
+					if modeErr != nil {
+						logger.Warn("failed to resolve enforcement mode", "mode", mode, "error", modeErr.Error())
+					}
+					if mode == EnforcementWarn {
+						logger.Info("denial shadowed", "message", wrw.deny.Message)
+						wrw.shadowDeny()
+					}
+				}
+
+				if resReview.Response, err = wrw.Build(reqReview.Request.UID); err != nil {
+					err = errors.New("failed to build AdmissionReview response: " + err.Error())
+					return
+				}
+			}
+
+			if failure == "" && opts.VerifyPatch && len(resReview.Response.Patch) != 0 {
+				if err = verifyJSONPatch(reqReview.Request, resReview.Response.Patch); err != nil {
+					if opts.VerifyPatchFallback == FallbackError {
+						err = errors.New("patch verification failed: " + err.Error())
+						return
+					}
+					applyFallback(resReview.Response, opts.VerifyPatchFallback, "patch verification failed: "+err.Error())
+					logger.Warn("patch verification failed", "decision", admissionDecision(resReview.Response, nil), "error", err.Error())
+					err = nil
+				}
+			}
 		}
 
 		// send response
-		var buf []byte
-		if opts.Debug {
-			buf, err = json.MarshalIndent(resReview, "", "  ")
-		} else {
-			buf, err = json.Marshal(resReview)
-		}
-		if err != nil {
-			err = errors.New("failed to marshal AdmissionReview response: " + err.Error())
+		if err = writeAdmissionReview(rw, resReview, logger, opts.Debug); err != nil {
 			return
 		}
 
-		if opts.Debug {
-			log.Println("Response:")
-			log.Println(string(buf))
+		logger.Log(req.Context(), summaryLevel, "admission request handled", "decision", admissionDecision(resReview.Response, nil))
+	}
+}
+
+// metricPathOf path label of metrics, the pattern of http.ServeMux the handler is mounted on, rather than
+// the requested path, keeping cardinality bounded; '/' if not mounted on a http.ServeMux
+func metricPathOf(req *http.Request) string {
+	if req.Pattern == "" {
+		return "/"
+	}
+	return req.Pattern
+}
+
+// requestLogAttrs attributes of req for logging
+func requestLogAttrs(req *admissionv1.AdmissionRequest) []any {
+	if req == nil {
+		return nil
+	}
+	return []any{
+		"uid", req.UID,
+		"kind", req.Kind.Kind,
+		"namespace", req.Namespace,
+		"name", req.Name,
+		"operation", req.Operation,
+	}
+}
+
+// admissionDecision describe the decision of res, 'error' if err is not nil
+func admissionDecision(res *admissionv1.AdmissionResponse, err error) string {
+	if err != nil || res == nil {
+		return "error"
+	}
+	if res.Allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// handlerTimeout determine timeout of WebhookHandler, from the 'timeout' query parameter set by API server,
+// with a margin reserved for responding, and the configured max timeout
+func handlerTimeout(req *http.Request, max time.Duration) (timeout time.Duration) {
+	if v, err := time.ParseDuration(req.URL.Query().Get("timeout")); err == nil && v > 0 {
+		timeout = v - min(v/10, time.Second)
+	}
+	if max > 0 && (timeout == 0 || max < timeout) {
+		timeout = max
+	}
+	return
+}
+
+// webhookPanicError error recovered from a panicking WebhookHandler
+type webhookPanicError struct {
+	value any
+}
+
+func (e *webhookPanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// invokeWebhookHandler invoke handler, recovering panic into webhookPanicError
+func invokeWebhookHandler(ctx context.Context, logger *slog.Logger, handler WebhookHandler, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("webhook handler panicked", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			err = &webhookPanicError{value: r}
+		}
+	}()
+	return handler(ctx, req, rw)
+}
+
+// writeAdmissionReview marshal and write a AdmissionReview response
+func writeAdmissionReview(rw http.ResponseWriter, review admissionv1.AdmissionReview, logger *slog.Logger, debug bool) (err error) {
+	return writeJSONResponse(rw, encodeAdmissionReview(review), logger, debug, "admission response sent")
+}
+
+// WebhookRoute a WebhookHandler mounted on a path
+type WebhookRoute struct {
+	// Path path to mount, a path ending with '/' matches the whole subtree, see http.ServeMux
+	Path string
+	// Options options for wrapping Handler
+	Options WrapWebhookHandlerOptions
+	// Handler the WebhookHandler
+	Handler WebhookHandler
+}
+
+// NewWebhookRouter create a http.ServeMux dispatching requests to routes by path,
+// requests to unknown paths are answered with a 404 AdmissionReview error,
+// unless a route is mounted on '/'; like http.ServeMux#Handle, it panics if a path is invalid,
+// mounted more than once, or conflicts with another path
+func NewWebhookRouter(routes ...WebhookRoute) *http.ServeMux {
+	mux, err := newWebhookRouter(slog.Default(), routes, nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return mux
+}
+
+// reservedPaths paths served by WebhookServer itself, routes mounted on them would never be reached
+var reservedPaths = []string{"/healthz", "/readyz"}
+
+// routePathOf path part of a http.ServeMux pattern, without method and host
+func routePathOf(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		pattern = pattern[i:]
+	}
+	return pattern
+}
+
+// checkRoutePaths check for paths mounted more than once, and paths reserved by WebhookServer
+func checkRoutePaths(routes []WebhookRoute, conversions []ConversionRoute, authorizations []AuthorizationRoute) error {
+	var paths []string
+	for _, route := range routes {
+		paths = append(paths, route.Path)
+	}
+	for _, route := range conversions {
+		paths = append(paths, route.Path)
+	}
+	for _, route := range authorizations {
+		paths = append(paths, route.Path)
+	}
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if slices.Contains(reservedPaths, routePathOf(path)) {
+			return errors.New("path " + strconv.Quote(path) + " is reserved for health checks")
+		}
+		if seen[path] {
+			return errors.New("path " + strconv.Quote(path) + " is mounted more than once, note that Handler is mounted on '/'")
+		}
+		seen[path] = true
+	}
+	return nil
+}
+
+// newWebhookRouter create the http.ServeMux of NewWebhookRouter, panics of http.ServeMux#Handle on invalid
+// or conflicting paths are recovered into err
+func newWebhookRouter(logger *slog.Logger, routes []WebhookRoute, conversions []ConversionRoute, authorizations []AuthorizationRoute) (mux *http.ServeMux, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			mux = nil
+			err = fmt.Errorf("invalid route: %v", r)
+		}
+	}()
+
+	mux = http.NewServeMux()
+
+	var hasRoot bool
+
+	for _, route := range routes {
+		if route.Path == "/" {
+			hasRoot = true
 		}
+		mux.Handle(route.Path, WrapWebhookHandler(route.Options, route.Handler))
+	}
+
+	for _, route := range conversions {
+		if route.Path == "/" {
+			hasRoot = true
+		}
+		mux.Handle(route.Path, WrapConversionHandler(route.Options, route.Handler))
+	}
+
+	for _, route := range authorizations {
+		if route.Path == "/" {
+			hasRoot = true
+		}
+		mux.Handle(route.Path, WrapAuthorizationHandler(route.Options, route.Handler))
+	}
+
+	if !hasRoot {
+		mux.Handle("/", webhookNotFoundHandler(logger))
+	}
+
+	return
+}
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.Header().Set("Content-Length", strconv.Itoa(len(buf)))
-		_, _ = rw.Write(buf)
+// webhookNotFoundHandler answer a AdmissionReview with a 404 error, the review is sent with
+// HTTP status 200, otherwise the API server will discard the message
+func webhookNotFoundHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		serveWebhookNotFound(logger, rw, req)
 	}
 }
 
+func serveWebhookNotFound(logger *slog.Logger, rw http.ResponseWriter, req *http.Request) {
+	reqReview, err := decodeAdmissionReview(http.MaxBytesReader(rw, req.Body, DefaultMaxBodySize))
+	if err != nil || reqReview.Request == nil {
+		http.NotFound(rw, req)
+		return
+	}
+
+	logger.Warn("no webhook handler for path", append([]any{"path", req.URL.Path, "decision", "denied"}, requestLogAttrs(reqReview.Request)...)...)
+
+	_ = writeAdmissionReview(rw, admissionv1.AdmissionReview{
+		TypeMeta: reqReview.TypeMeta,
+		Response: &admissionv1.AdmissionResponse{
+			UID:     reqReview.Request.UID,
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: "no webhook handler for path: " + req.URL.Path,
+				Reason:  metav1.StatusReasonNotFound,
+				Code:    http.StatusNotFound,
+			},
+		},
+	}, logger, false)
+}
+
 // WebhookServer webhook server abstraction
 type WebhookServer interface {
 	// ListenAndServe wraps internal http.Server#ListenAndServeTLS()
@@ -234,6 +862,9 @@ type WebhookServer interface {
 
 	// Shutdown wraps internal http.Server#Shutdown()
 	Shutdown(ctx context.Context) error
+
+	// AddReadinessCheck register a named check for '/readyz', in addition to the built-in certificate check
+	AddReadinessCheck(name string, check ReadinessCheck)
 }
 
 // WebhookServerOptions options for WebhookServer
@@ -242,7 +873,25 @@ type WebhookServerOptions struct {
 	CertFile string
 	KeyFile  string
 	Debug    bool
-	Handler  WebhookHandler
+	// Handler WebhookHandler mounted on '/', serving all paths not matched by Routes; conflicts with
+	// any route mounted on '/', ListenAndServe fails if a path is invalid, mounted more than once,
+	// conflicts with another path, or is one of '/healthz' and '/readyz'
+	Handler WebhookHandler
+	// Routes WebhookHandlers mounted on their own paths
+	Routes []WebhookRoute
+	// ConversionRoutes ConversionHandlers of CRD conversion webhooks mounted on their own paths
+	ConversionRoutes []ConversionRoute
+	// AuthorizationRoutes AuthorizationHandlers of authorization webhooks mounted on their own paths
+	AuthorizationRoutes []AuthorizationRoute
+	// MetricsPort if not zero, metrics of all handlers are served in Prometheus text format
+	// at '/metrics' on this port, over plain HTTP
+	MetricsPort int
+	// CertReloadInterval interval of polling CertFile and KeyFile for changes, negative to disable reloading
+	CertReloadInterval time.Duration
+	// TLS TLS options, including client certificate authentication
+	TLS WebhookServerTLSOptions
+	// Logger logger for server and all handlers, default to slog.Default()
+	Logger *slog.Logger
 }
 
 var (
@@ -250,6 +899,8 @@ var (
 		Port:     443,
 		CertFile: "/admission-server/tls.crt",
 		KeyFile:  "/admission-server/tls.key",
+
+		CertReloadInterval: time.Second * 10,
 	}
 )
 
@@ -259,12 +910,63 @@ func DefaultWebhookServerOptions() WebhookServerOptions {
 }
 
 type webhookServer struct {
-	opts WebhookServerOptions
-	s    *http.Server
+	opts   WebhookServerOptions
+	s      *http.Server
+	ms     *http.Server
+	certs  *certificateLoader
+	checks *readinessChecks
+	ctx    context.Context
+	cancel context.CancelFunc
+	// err error of options, returned by ListenAndServe
+	err error
+}
+
+func (w *webhookServer) listenAndServeTLS() (err error) {
+	if w.s.TLSConfig, err = createTLSConfig(w.opts.TLS, w.certs.GetCertificate); err != nil {
+		return
+	}
+
+	if _, err = w.certs.load(); err != nil {
+		return
+	}
+
+	if w.opts.CertReloadInterval > 0 {
+		go w.certs.watch(w.ctx, w.opts.CertReloadInterval)
+	}
+
+	// stop watching once the server is not serving, including failing to listen
+	defer w.cancel()
+
+	return w.s.ListenAndServeTLS("", "")
+}
+
+func (w *webhookServer) AddReadinessCheck(name string, check ReadinessCheck) {
+	w.checks.add(name, check)
 }
 
-func (w *webhookServer) ListenAndServe() error {
-	return w.s.ListenAndServeTLS(w.opts.CertFile, w.opts.KeyFile)
+func (w *webhookServer) ListenAndServe() (err error) {
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.ms == nil {
+		return w.listenAndServeTLS()
+	}
+
+	chErr := make(chan error, 2)
+
+	go func() {
+		chErr <- w.ms.ListenAndServe()
+	}()
+	go func() {
+		chErr <- w.listenAndServeTLS()
+	}()
+
+	// stop the other server if one failed
+	if err = <-chErr; !errors.Is(err, http.ErrServerClosed) {
+		_ = w.Shutdown(context.Background())
+	}
+	return
 }
 
 func (w *webhookServer) ListenAndServeGracefully() (err error) {
@@ -279,14 +981,19 @@ func (w *webhookServer) ListenAndServeGracefully() (err error) {
 	select {
 	case err = <-chErr:
 	case sig := <-chSig:
-		log.Println("signal caught:", sig.String())
+		w.opts.Logger.Info("signal caught", "signal", sig.String())
 		err = w.Shutdown(context.Background())
 	}
 	return
 }
 
 func (w *webhookServer) Shutdown(ctx context.Context) error {
-	return w.s.Shutdown(ctx)
+	w.cancel()
+
+	if w.ms == nil {
+		return w.s.Shutdown(ctx)
+	}
+	return errors.Join(w.s.Shutdown(ctx), w.ms.Shutdown(ctx))
 }
 
 // NewWebhookServer create a WebhookServer
@@ -301,21 +1008,112 @@ func NewWebhookServer(opts WebhookServerOptions) WebhookServer {
 	if opts.KeyFile == "" {
 		opts.KeyFile = dfo.KeyFile
 	}
-	if opts.Handler == nil {
+	if opts.CertReloadInterval == 0 {
+		opts.CertReloadInterval = dfo.CertReloadInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.Handler == nil && len(opts.Routes) == 0 && len(opts.ConversionRoutes) == 0 && len(opts.AuthorizationRoutes) == 0 {
 		opts.Handler = func(_ context.Context, _ *admissionv1.AdmissionRequest, _ WebhookResponseWriter) error {
 			return nil
 		}
 	}
-	return &webhookServer{
+
+	var metrics *WebhookMetrics
+	if opts.MetricsPort != 0 {
+		metrics = NewWebhookMetrics()
+	}
+
+	var routes []WebhookRoute
+	for _, route := range opts.Routes {
+		if opts.Debug {
+			route.Options.Debug = true
+		}
+		if route.Options.Metrics == nil {
+			route.Options.Metrics = metrics
+		}
+		if route.Options.Logger == nil {
+			route.Options.Logger = opts.Logger
+		}
+		routes = append(routes, route)
+	}
+	var conversions []ConversionRoute
+	for _, route := range opts.ConversionRoutes {
+		if opts.Debug {
+			route.Options.Debug = true
+		}
+		if route.Options.Logger == nil {
+			route.Options.Logger = opts.Logger
+		}
+		conversions = append(conversions, route)
+	}
+	var authorizations []AuthorizationRoute
+	for _, route := range opts.AuthorizationRoutes {
+		if opts.Debug {
+			route.Options.Debug = true
+		}
+		if route.Options.Logger == nil {
+			route.Options.Logger = opts.Logger
+		}
+		authorizations = append(authorizations, route)
+	}
+	if opts.Handler != nil {
+		routes = append(routes, WebhookRoute{
+			Path: "/",
+			Options: WrapWebhookHandlerOptions{
+				Debug:   opts.Debug,
+				Metrics: metrics,
+				Logger:  opts.Logger,
+			},
+			Handler: opts.Handler,
+		})
+	}
+
+	w := &webhookServer{
 		opts: opts,
-		s: &http.Server{
-			Addr: ":" + strconv.Itoa(opts.Port),
-			Handler: WrapWebhookHandler(
-				WrapWebhookHandlerOptions{
-					Debug: opts.Debug,
-				},
-				opts.Handler,
-			),
+		certs: &certificateLoader{
+			certFile: opts.CertFile,
+			keyFile:  opts.KeyFile,
+			logger:   opts.Logger,
 		},
+		checks: &readinessChecks{},
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+
+	w.checks.add("certificate", func(ctx context.Context) error {
+		return checkCertificate(w.certs.cert.Load())
+	})
+
+	var router http.Handler = http.NotFoundHandler()
+	if w.err = checkRoutePaths(routes, conversions, authorizations); w.err == nil {
+		var mux *http.ServeMux
+		if mux, w.err = newWebhookRouter(opts.Logger, routes, conversions, authorizations); w.err == nil {
+			router = mux
+		}
+	}
+	if opts.TLS.ClientCAFile != "" {
+		router = requireClientCertificate(opts.TLS.ClientNames, router)
 	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.Handle("/readyz", serveReadyz(w.checks))
+	mux.Handle("/", router)
+
+	w.s = &http.Server{
+		Addr:    ":" + strconv.Itoa(opts.Port),
+		Handler: mux,
+	}
+
+	if metrics != nil {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		w.ms = &http.Server{
+			Addr:    ":" + strconv.Itoa(opts.MetricsPort),
+			Handler: mux,
+		}
+	}
+
+	return w
 }
@@ -0,0 +1,432 @@
+package ezadmis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func serveAdmissionReview(t *testing.T, h http.Handler, path string, req *admissionv1.AdmissionRequest) *httptest.ResponseRecorder {
+	buf, err := json.Marshal(admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: admissionv1.SchemeGroupVersion.String(),
+			Kind:       "AdmissionReview",
+		},
+		Request: req,
+	})
+	require.NoError(t, err)
+
+	hreq := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(buf))
+	hreq.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, hreq)
+	return rec
+}
+
+func postAdmissionReview(t *testing.T, h http.Handler, path string, req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	rec := serveAdmissionReview(t, h, path, req)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	var res admissionv1.AdmissionReview
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.NotNil(t, res.Response)
+	require.Equal(t, req.UID, res.Response.UID)
+	return res.Response
+}
+
+func TestNewWebhookRouter(t *testing.T) {
+	h := NewWebhookRouter(
+		WebhookRoute{
+			Path: "/validate/pods",
+			Handler: func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+				rw.Deny("pods denied")
+				return
+			},
+		},
+		WebhookRoute{
+			Path: "/mutate/deployments",
+			Handler: func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+				rw.PatchAdd("/metadata/labels/hello", "world")
+				return
+			},
+		},
+	)
+
+	res := postAdmissionReview(t, h, "/validate/pods", &admissionv1.AdmissionRequest{UID: "1"})
+	require.False(t, res.Allowed)
+	require.Equal(t, "pods denied", res.Result.Message)
+
+	res = postAdmissionReview(t, h, "/mutate/deployments", &admissionv1.AdmissionRequest{UID: "2"})
+	require.True(t, res.Allowed)
+	require.JSONEq(t, `[{"op":"add","path":"/metadata/labels/hello","value":"world"}]`, string(res.Patch))
+
+	res = postAdmissionReview(t, h, "/unknown", &admissionv1.AdmissionRequest{UID: "3"})
+	require.False(t, res.Allowed)
+	require.Equal(t, int32(http.StatusNotFound), res.Result.Code)
+	require.Equal(t, metav1.StatusReasonNotFound, res.Result.Reason)
+}
+
+func TestWebhookResponseWriterPatchObject(t *testing.T) {
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		var obj map[string]any
+		if err = json.Unmarshal(req.Object.Raw, &obj); err != nil {
+			return
+		}
+		obj["metadata"].(map[string]any)["labels"] = map[string]any{"hello": "world"}
+		rw.PatchObject(obj)
+		rw.PatchAdd("/metadata/annotations", map[string]any{"foo": "bar"})
+		return
+	})
+
+	res := postAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{
+		UID: "1",
+		Object: runtime.RawExtension{
+			Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"test"}}`),
+		},
+	})
+	require.True(t, res.Allowed)
+	require.Equal(t, admissionv1.PatchTypeJSONPatch, *res.PatchType)
+	require.JSONEq(t, `[
+		{"op":"add","path":"/metadata/labels","value":{"hello":"world"}},
+		{"op":"add","path":"/metadata/annotations","value":{"foo":"bar"}}
+	]`, string(res.Patch))
+}
+
+func TestWebhookResponseWriterPatchObjectUnknownFields(t *testing.T) {
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		pod := &corev1.Pod{}
+		if err = json.Unmarshal(req.Object.Raw, pod); err != nil {
+			return
+		}
+		if pod.Name == "mutated" {
+			pod.Labels = map[string]string{"hello": "world"}
+		}
+		rw.PatchObject(pod)
+		return
+	})
+
+	raw := func(name string) []byte {
+		return []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"` + name + `"},` +
+			`"spec":{"newPodField":true,"containers":[{"name":"a","image":"b","futureField":1}]}}`)
+	}
+
+	// unchanged object results in no operations, fields unknown to corev1.Pod are kept
+	res := postAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{
+		UID:    "1",
+		Object: runtime.RawExtension{Raw: raw("test")},
+	})
+	require.True(t, res.Allowed)
+	require.Nil(t, res.PatchType)
+	require.Empty(t, res.Patch)
+
+	// only edits of handler become operations
+	res = postAdmissionReview(t, h, "/", &admissionv1.AdmissionRequest{
+		UID:    "2",
+		Object: runtime.RawExtension{Raw: raw("mutated")},
+	})
+	require.True(t, res.Allowed)
+	require.JSONEq(t, `[{"op":"add","path":"/metadata/labels","value":{"hello":"world"}}]`, string(res.Patch))
+}
+
+func TestWebhookResponseWriterWarnAndAuditAnnotate(t *testing.T) {
+	rw := &webhookResponseWriter{}
+
+	rw.Warn("  this will be denied next month\n")
+	rw.Warn("this will be denied next month")
+	rw.Warn("")
+	rw.Warn(strings.Repeat("a", MaxWarningLength+10))
+	require.Equal(t, []string{
+		"this will be denied next month",
+		strings.Repeat("a", MaxWarningLength-3) + "...",
+	}, rw.warnings)
+
+	for i := 0; i < MaxWarningsLength; i++ {
+		rw.Warn(strconv.Itoa(i) + strings.Repeat("b", 100))
+	}
+	require.LessOrEqual(t, rw.warningsLength, MaxWarningsLength)
+
+	require.NoError(t, rw.AuditAnnotate("policy.version", "1"))
+	require.Error(t, rw.AuditAnnotate("example.com/policy", "1"))
+	require.Error(t, rw.AuditAnnotate("-invalid", "1"))
+	require.Error(t, rw.AuditAnnotate(strings.Repeat("a", 64), "1"))
+
+	rw.Deny("denied")
+
+	res, err := rw.Build("1")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, rw.warnings, res.Warnings)
+	require.Equal(t, map[string]string{"policy.version": "1"}, res.AuditAnnotations)
+}
+
+func TestWebhookResponseWriterDenyStatus(t *testing.T) {
+	rw := &webhookResponseWriter{}
+	rw.PatchAdd("/metadata/labels", map[string]any{})
+	rw.DenyStatus(kerrors.NewInvalid(
+		schema.GroupKind{Kind: "Pod"},
+		"test",
+		field.ErrorList{
+			field.Required(field.NewPath("spec", "containers").Index(0).Child("resources", "limits"), "limits are required"),
+		},
+	).ErrStatus)
+
+	res, err := rw.Build("1")
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Nil(t, res.Patch)
+	require.Equal(t, metav1.StatusFailure, res.Result.Status)
+	require.Equal(t, metav1.StatusReasonInvalid, res.Result.Reason)
+	require.Equal(t, int32(http.StatusUnprocessableEntity), res.Result.Code)
+	require.Len(t, res.Result.Details.Causes, 1)
+	require.Equal(t, "spec.containers[0].resources.limits", res.Result.Details.Causes[0].Field)
+
+	rw = &webhookResponseWriter{}
+	rw.DenyStatus(metav1.Status{
+		Message: "forbidden by policy",
+		Reason:  metav1.StatusReasonForbidden,
+	})
+	res, err = rw.Build("1")
+	require.NoError(t, err)
+	require.Equal(t, int32(http.StatusForbidden), res.Result.Code)
+
+	rw.Deny("")
+	res, err = rw.Build("1")
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+}
+
+func TestWrapWebhookHandlerFailureFallback(t *testing.T) {
+	panicking := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		panic("boom")
+	}
+	blocking := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	// failurePolicy of the webhook configuration decides by default
+	rec := serveAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{}, panicking), "/", &admissionv1.AdmissionRequest{UID: "1"})
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), "panicked")
+
+	rec = serveAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{Timeout: time.Millisecond * 50}, blocking), "/", &admissionv1.AdmissionRequest{UID: "2"})
+	require.Equal(t, http.StatusInternalServerError, rec.Code)
+	require.Contains(t, rec.Body.String(), "timed out")
+
+	res := postAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{FailureFallback: FallbackDeny}, panicking), "/", &admissionv1.AdmissionRequest{UID: "3"})
+	require.False(t, res.Allowed)
+	require.Equal(t, int32(http.StatusInternalServerError), res.Result.Code)
+
+	res = postAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{FailureFallback: FallbackAllow}, panicking), "/", &admissionv1.AdmissionRequest{UID: "4"})
+	require.True(t, res.Allowed)
+
+	res = postAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{Timeout: time.Millisecond * 50, FailureFallback: FallbackDeny}, blocking), "/", &admissionv1.AdmissionRequest{UID: "5"})
+	require.False(t, res.Allowed)
+	require.Contains(t, res.Result.Message, "timed out")
+
+	res = postAdmissionReview(t, WrapWebhookHandler(WrapWebhookHandlerOptions{FailureFallback: FallbackAllow}, blocking), "/?timeout=100ms", &admissionv1.AdmissionRequest{UID: "6"})
+	require.True(t, res.Allowed)
+}
+
+func TestWrapWebhookHandlerVerifyPatchFallback(t *testing.T) {
+	handler := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		if req.Name == "bad" {
+			// removing a missing label fails to apply
+			rw.PatchRemove("/metadata/labels/missing")
+		} else {
+			rw.PatchAdd("/metadata/labels", map[string]string{"a": "b"})
+		}
+		return
+	}
+
+	req := func(uid types.UID, name string) *admissionv1.AdmissionRequest {
+		return &admissionv1.AdmissionRequest{
+			UID:  uid,
+			Name: name,
+			Kind: metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Object: runtime.RawExtension{
+				Raw: []byte(`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"` + name + `"}}`),
+			},
+		}
+	}
+
+	for _, policy := range []FallbackPolicy{FallbackError, FallbackDeny, FallbackAllow} {
+		h := WrapWebhookHandler(WrapWebhookHandlerOptions{VerifyPatch: true, VerifyPatchFallback: policy}, handler)
+
+		// good patch is kept
+		res := postAdmissionReview(t, h, "/", req("1", "good"))
+		require.True(t, res.Allowed)
+		require.JSONEq(t, `[{"op":"add","path":"/metadata/labels","value":{"a":"b"}}]`, string(res.Patch))
+
+		// bad patch is dropped, and fallback decides
+		if policy == FallbackError {
+			rec := serveAdmissionReview(t, h, "/", req("2", "bad"))
+			require.Equal(t, http.StatusInternalServerError, rec.Code)
+			require.Contains(t, rec.Body.String(), "patch verification failed")
+			continue
+		}
+		res = postAdmissionReview(t, h, "/", req("2", "bad"))
+		require.Nil(t, res.Patch)
+		require.Nil(t, res.PatchType)
+		if policy == FallbackAllow {
+			require.True(t, res.Allowed)
+			require.Nil(t, res.Result)
+		} else {
+			require.False(t, res.Allowed)
+			require.Equal(t, int32(http.StatusInternalServerError), res.Result.Code)
+			require.Contains(t, res.Result.Message, "patch verification failed")
+		}
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	require.Equal(t, time.Duration(0), handlerTimeout(httptest.NewRequest(http.MethodPost, "/", nil), 0))
+	require.Equal(t, time.Second*9, handlerTimeout(httptest.NewRequest(http.MethodPost, "/?timeout=10s", nil), 0))
+	require.Equal(t, time.Second*29, handlerTimeout(httptest.NewRequest(http.MethodPost, "/?timeout=30s", nil), 0))
+	require.Equal(t, time.Second*5, handlerTimeout(httptest.NewRequest(http.MethodPost, "/?timeout=30s", nil), time.Second*5))
+	require.Equal(t, time.Second*5, handlerTimeout(httptest.NewRequest(http.MethodPost, "/", nil), time.Second*5))
+}
+
+func TestWrapWebhookHandlerLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{
+		Debug:  true,
+		Logger: slog.New(slog.NewJSONHandler(buf, nil)),
+	}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		rw.Deny("denied")
+		return
+	})
+
+	postAdmissionReview(t, h, "/validate", &admissionv1.AdmissionRequest{
+		UID:       "test-uid",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "default",
+		Name:      "test",
+		Operation: admissionv1.Create,
+	})
+
+	var last map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		require.NoError(t, json.Unmarshal([]byte(line), &last))
+		require.Equal(t, "test-uid", last["uid"])
+		require.Equal(t, "Pod", last["kind"])
+		require.Equal(t, "default", last["namespace"])
+		require.Equal(t, "test", last["name"])
+		require.Equal(t, "CREATE", last["operation"])
+	}
+	require.Equal(t, "admission request handled", last["msg"])
+	require.Equal(t, "denied", last["decision"])
+}
+
+func TestWrapWebhookHandlerRequestValidation(t *testing.T) {
+	h := WrapWebhookHandler(WrapWebhookHandlerOptions{MaxBodySize: 64}, func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		return
+	})
+
+	serve := func(method string, contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "application/json", "")
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+
+	rec = serve(http.MethodPost, "text/plain", "{}")
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = serve(http.MethodPost, "", "{}")
+	require.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	rec = serve(http.MethodPost, "application/json; charset=utf-8", `{"request":{"uid":"`+strings.Repeat("a", 64)+`"}}`)
+	require.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = serve(http.MethodPost, "application/json", `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Contains(t, rec.Body.String(), ErrMissingRequest.Error())
+
+	rec = serve(http.MethodPost, "application/json", `{"request":{"uid":"1"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestNewWebhookServerConflictingPaths(t *testing.T) {
+	handler := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		return
+	}
+
+	var s WebhookServer
+	require.NotPanics(t, func() {
+		s = NewWebhookServer(WebhookServerOptions{
+			Handler: handler,
+			Routes:  []WebhookRoute{{Path: "/", Handler: handler}},
+		})
+	})
+	err := s.ListenAndServe()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `path "/" is mounted more than once`)
+
+	require.NotPanics(t, func() {
+		s = NewWebhookServer(WebhookServerOptions{
+			Routes:           []WebhookRoute{{Path: "/foos", Handler: handler}},
+			ConversionRoutes: []ConversionRoute{{Path: "/foos"}},
+		})
+	})
+	require.Error(t, s.ListenAndServe())
+}
+
+func TestNewWebhookServerInvalidPaths(t *testing.T) {
+	handler := func(ctx context.Context, req *admissionv1.AdmissionRequest, rw WebhookResponseWriter) (err error) {
+		return
+	}
+
+	for _, item := range []struct {
+		routes []WebhookRoute
+		msg    string
+	}{
+		{routes: []WebhookRoute{{Path: ""}}, msg: "invalid pattern"},
+		{routes: []WebhookRoute{{Path: "validate"}}, msg: "missing /"},
+		{routes: []WebhookRoute{{Path: "/a/{y}"}, {Path: "/{x}/b"}}, msg: "conflicts"},
+		{routes: []WebhookRoute{{Path: "/healthz"}}, msg: `path "/healthz" is reserved`},
+		{routes: []WebhookRoute{{Path: "POST /readyz"}}, msg: `path "POST /readyz" is reserved`},
+	} {
+		for i := range item.routes {
+			item.routes[i].Handler = handler
+		}
+
+		var s WebhookServer
+		require.NotPanics(t, func() {
+			s = NewWebhookServer(WebhookServerOptions{Routes: item.routes})
+		})
+		err := s.ListenAndServe()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), item.msg)
+	}
+
+	require.Panics(t, func() {
+		NewWebhookRouter(WebhookRoute{Path: "validate", Handler: handler})
+	})
+}